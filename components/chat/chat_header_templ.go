@@ -8,7 +8,7 @@ package chat
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
-func ChatHeader() templ.Component {
+func ChatHeader(title string) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -29,7 +29,20 @@ func ChatHeader() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<header class=\"w-full bg-zinc-950/90 backdrop-blur-xl border-b border-zinc-800 sticky top-0 z-50 transition-colors duration-300\" role=\"banner\"><div class=\"h-16 flex items-center justify-between px-4 sm:px-6 max-w-7xl mx-auto w-full\"><!-- Left: Text Branding --><div class=\"flex items-center flex-1\"><a href=\"/\" class=\"group flex items-center gap-2 rounded-2xl py-2 px-3 -ml-2 focus-visible:outline-none focus-visible:ring-2 focus-visible:ring-blue-500 focus-visible:ring-offset-2 focus-visible:ring-offset-zinc-950 transition-all duration-200 hover:bg-zinc-900/50\" aria-label=\"Chatter home\"><h1 class=\"text-xl font-bold text-white group-hover:text-blue-100 transition-colors duration-200\">Chatter</h1></a></div><!-- Right: Status and Actions --><div class=\"flex items-center gap-4 sm:gap-6\"><!-- Presence Indicator --><div class=\"flex items-center gap-2\" role=\"status\" aria-live=\"polite\" aria-atomic=\"true\" title=\"Online Users\"><span class=\"relative flex h-2.5 w-2.5\" aria-hidden=\"true\"><span class=\"motion-safe:animate-ping absolute inline-flex h-full w-full rounded-full bg-emerald-500 opacity-75 duration-1000\"></span> <span class=\"relative inline-flex rounded-full h-full w-full bg-emerald-500 shadow-[0_0_8px_rgba(16,185,129,0.5)]\"></span></span><!-- Switched to text-white for maximum visibility --><span id=\"presence-count\" class=\"text-sm font-medium text-white tabular-nums transition-colors duration-200\"></span></div><!-- Divider --><div class=\"h-6 w-px bg-zinc-800 hidden sm:block\" aria-hidden=\"true\"></div><!-- User Actions Navigation --><nav class=\"flex items-center\" aria-label=\"User account\"><button hx-post=\"/account/logout\" hx-confirm=\"Are you sure you want to log out?\" hx-indicator=\"#logout-indicator\" hx-disabled-elt=\"this\" class=\"relative cursor-pointer text-sm font-medium text-white transition-colors duration-200 focus-visible:outline-none focus-visible:ring-2 focus-visible:ring-blue-500 focus-visible:ring-offset-2 focus-visible:ring-offset-zinc-950 px-4 py-2 rounded-lg border border-transparent hover:bg-red-500/10 hover:text-red-400 hover:border-red-500/20 disabled:opacity-50 disabled:cursor-not-allowed\" type=\"button\"><span class=\"htmx-indicator-hidden\">Log out</span></button></nav></div></div></header>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<header class=\"w-full bg-zinc-950/90 backdrop-blur-xl border-b border-zinc-800 sticky top-0 z-50 transition-colors duration-300\" role=\"banner\"><div class=\"h-16 flex items-center justify-between px-4 sm:px-6 max-w-7xl mx-auto w-full\"><!-- Left: Text Branding --><div class=\"flex items-center flex-1\"><a href=\"/\" class=\"group flex items-center gap-2 rounded-2xl py-2 px-3 -ml-2 focus-visible:outline-none focus-visible:ring-2 focus-visible:ring-blue-500 focus-visible:ring-offset-2 focus-visible:ring-offset-zinc-950 transition-all duration-200 hover:bg-zinc-900/50\" aria-label=\"Chatter home\"><h1 class=\"text-xl font-bold text-white group-hover:text-blue-100 transition-colors duration-200\">Chatter</h1></a> <a href=\"/rooms\" class=\"text-sm font-medium text-gray-400 hover:text-white transition-colors duration-200\" title=\"Browse rooms\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var2 string
+		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(title)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/chat/chat_header.templ`, Line: 23, Col: 12}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "</a> <a href=\"/search\" class=\"ml-4 text-sm font-medium text-gray-400 hover:text-white transition-colors duration-200\" title=\"Search messages\">Search</a></div><!-- Right: Status and Actions --><div class=\"flex items-center gap-4 sm:gap-6\"><!-- Presence Indicator --><div class=\"flex items-center gap-2\" role=\"status\" aria-live=\"polite\" aria-atomic=\"true\" title=\"Online Users\"><span class=\"relative flex h-2.5 w-2.5\" aria-hidden=\"true\"><span class=\"motion-safe:animate-ping absolute inline-flex h-full w-full rounded-full bg-emerald-500 opacity-75 duration-1000\"></span> <span class=\"relative inline-flex rounded-full h-full w-full bg-emerald-500 shadow-[0_0_8px_rgba(16,185,129,0.5)]\"></span></span><!-- Switched to text-white for maximum visibility --><span id=\"presence-count\" class=\"text-sm font-medium text-white tabular-nums transition-colors duration-200\"></span></div><!-- Unread Counter --><span id=\"unread-count\" class=\"text-sm font-medium text-blue-400 tabular-nums\" role=\"status\" title=\"Unread messages\"></span><!-- Divider --><div class=\"h-6 w-px bg-zinc-800 hidden sm:block\" aria-hidden=\"true\"></div><!-- User Actions Navigation --><nav class=\"flex items-center\" aria-label=\"User account\"><button hx-post=\"/account/logout\" hx-confirm=\"Are you sure you want to log out?\" hx-indicator=\"#logout-indicator\" hx-disabled-elt=\"this\" class=\"relative cursor-pointer text-sm font-medium text-white transition-colors duration-200 focus-visible:outline-none focus-visible:ring-2 focus-visible:ring-blue-500 focus-visible:ring-offset-2 focus-visible:ring-offset-zinc-950 px-4 py-2 rounded-lg border border-transparent hover:bg-red-500/10 hover:text-red-400 hover:border-red-500/20 disabled:opacity-50 disabled:cursor-not-allowed\" type=\"button\"><span class=\"htmx-indicator-hidden\">Log out</span></button></nav></div></div></header>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
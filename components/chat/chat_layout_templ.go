@@ -10,7 +10,9 @@ import templruntime "github.com/a-h/templ/runtime"
 
 import "github.com/johndosdos/chatter/components"
 
-func ChatLayout() templ.Component {
+// ChatLayout renders the chat of the channel at path. A non-zero around
+// loads the history surrounding that message instead of the latest one.
+func ChatLayout(title, path string, around int64) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -47,11 +49,11 @@ func ChatLayout() templ.Component {
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = ChatWindow().Render(ctx, templ_7745c5c3_Buffer)
+			templ_7745c5c3_Err = ChatWindow(title, path, around).Render(ctx, templ_7745c5c3_Buffer)
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<script>\n\t\t\t\tlet messageArea = document.getElementById(\"message-area\");\n\n\t\t\t\t// Add auto-scroll mechanism on new messages, with animation.\n\t\t\t\tdocument.body.addEventListener(\"htmx:oobAfterSwap\", () => {\n\t\t\t\t\tmessageArea.scroll({ top: messageArea.scrollHeight, behavior: \"smooth\" })\n\t\t\t\t});\n\n        let initialLoad = false;\n        document.body.addEventListener(\"htmx:wsOpen\", () => {\n          initialLoad = true;\n        });\n\n        document.body.addEventListener(\"htmx:wsConnecting\", () => {\n          if (!initialLoad) {\n            return;\n          }\n\n          let lastMsg = messageArea?.lastElementChild;\n          let messageID = lastMsg?.dataset.messageID;\n\n          if (!messageID) {\n            return\n          }\n\n          let url = new URL(\"/messages\", window.location.origin);\n          url.searchParams.set(\"messageID\", messageID);\n\n          htmx.ajax(\"GET\", url.toString(), { target: \"#message-area\", swap: \"beforeend\" });\n        });\n\n        let typingTimer = null;        \n        document.body.addEventListener(\"htmx:oobAfterSwap\", (event) => {\n          if (event.detail.target.id === \"typing-indicator\") {\n            const indicator = event.detail.target;\n            if (indicator.innerHTML.trim() !== \"\") {\n               indicator.classList.remove(\"hidden\");\n               \n               clearTimeout(typingTimer);\n               typingTimer = setTimeout(() => {\n                 indicator.innerHTML = \"\";\n                 indicator.classList.add(\"hidden\");\n               }, 3000);\n            }\n          }\n        });\n\t\t\t</script></div>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<script>\n\t\t\t\tlet messageArea = document.getElementById(\"message-area\");\n\n\t\t\t\t// Add auto-scroll mechanism on new messages, with animation.\n\t\t\t\tdocument.body.addEventListener(\"htmx:oobAfterSwap\", (event) => {\n\t\t\t\t\tlet target = event.detail.target;\n\n\t\t\t\t\t// Mention notifications go away on their own.\n\t\t\t\t\tif (target.id === \"notifications\") {\n\t\t\t\t\t\tlet notification = target.firstElementChild;\n\t\t\t\t\t\tsetTimeout(() => notification.remove(), 5000);\n\t\t\t\t\t\treturn;\n\t\t\t\t\t}\n\n\t\t\t\t\t// Replies scroll their thread pane instead.\n\t\t\t\t\tlet area = target.id.startsWith(\"thread-replies-\") ? target : messageArea;\n\t\t\t\t\tarea.scroll({ top: area.scrollHeight, behavior: \"smooth\" })\n\t\t\t\t\tmarkRead();\n\t\t\t\t});\n\n\t\t\t\t// Scroll to the newest message once the history is loaded, to the\n\t\t\t\t// message the user jumped to, or to the first unread one when the user\n\t\t\t\t// comes back.\n\t\t\t\tlet historyLoaded = false;\n\t\t\t\tdocument.body.addEventListener(\"htmx:afterSwap\", (event) => {\n\t\t\t\t\tif (event.detail.target.id !== \"message-area\") {\n\t\t\t\t\t\treturn;\n\t\t\t\t\t}\n\n\t\t\t\t\tlet divider = document.getElementById(\"unread-divider\");\n\t\t\t\t\tlet target = messageArea.querySelector(\"[data-target]\");\n\t\t\t\t\tif (!historyLoaded && target) {\n\t\t\t\t\t\ttarget.scrollIntoView({ block: \"center\" });\n\t\t\t\t\t} else if (!historyLoaded && divider) {\n\t\t\t\t\t\tdivider.scrollIntoView({ block: \"start\" });\n\t\t\t\t\t} else {\n\t\t\t\t\t\tmessageArea.scrollTop = messageArea.scrollHeight;\n\t\t\t\t\t}\n\t\t\t\t\thistoryLoaded = true;\n\t\t\t\t\tmarkRead();\n\t\t\t\t});\n\n\t\t\t\t// lastSeenMessageID returns the ID of the last message scrolled into\n\t\t\t\t// view. It is sent by the read marker.\n\t\t\t\tfunction lastSeenMessageID() {\n\t\t\t\t\tlet bottom = messageArea.getBoundingClientRect().bottom;\n\t\t\t\t\tlet messages = messageArea.querySelectorAll(\"[data-messageID]\");\n\t\t\t\t\tfor (let i = messages.length - 1; i >= 0; i--) {\n\t\t\t\t\t\tif (messages[i].getBoundingClientRect().top < bottom) {\n\t\t\t\t\t\t\treturn Number(messages[i].getAttribute(\"data-messageID\"));\n\t\t\t\t\t\t}\n\t\t\t\t\t}\n\t\t\t\t\treturn 0;\n\t\t\t\t}\n\n\t\t\t\t// Move the read marker forward while the user is looking at the chat.\n\t\t\t\tlet lastMarkedID = 0;\n\t\t\t\tfunction markRead() {\n\t\t\t\t\tif (document.visibilityState !== \"visible\" || !document.hasFocus()) {\n\t\t\t\t\t\treturn;\n\t\t\t\t\t}\n\n\t\t\t\t\tlet messageID = lastSeenMessageID();\n\t\t\t\t\tif (messageID > lastMarkedID) {\n\t\t\t\t\t\tlastMarkedID = messageID;\n\t\t\t\t\t\thtmx.trigger(\"#read-marker\", \"markRead\");\n\t\t\t\t\t}\n\t\t\t\t}\n\t\t\t\t// Acknowledge the messages of other users once they are rendered.\n\t\t\t\tlet pendingAcks = [];\n\t\t\t\tfunction takeAcks() {\n\t\t\t\t\tlet ids = pendingAcks;\n\t\t\t\t\tpendingAcks = [];\n\t\t\t\t\treturn ids;\n\t\t\t\t}\n\t\t\t\tfunction queueAcks() {\n\t\t\t\t\tmessageArea.querySelectorAll(\"[data-ack]\").forEach((message) => {\n\t\t\t\t\t\tpendingAcks.push(Number(message.getAttribute(\"data-messageID\")));\n\t\t\t\t\t\tmessage.removeAttribute(\"data-ack\");\n\t\t\t\t\t});\n\t\t\t\t\tif (pendingAcks.length > 0) {\n\t\t\t\t\t\thtmx.trigger(\"#acknowledgements\", \"ack\");\n\t\t\t\t\t}\n\t\t\t\t}\n\t\t\t\tdocument.body.addEventListener(\"htmx:afterSwap\", queueAcks);\n\t\t\t\tdocument.body.addEventListener(\"htmx:oobAfterSwap\", queueAcks);\n\n\t\t\t\tmessageArea.addEventListener(\"scroll\", markRead);\n\t\t\t\twindow.addEventListener(\"focus\", markRead);\n\t\t\t\tdocument.addEventListener(\"visibilitychange\", markRead);\n\n\t\t\t\t// Older messages are prepended in place of the history sentinel. Keep\n\t\t\t\t// the current messages in view; otherwise the next sentinel is\n\t\t\t\t// immediately scrolled into view and the whole history gets loaded.\n\t\t\t\tdocument.body.addEventListener(\"htmx:beforeSwap\", (event) => {\n\t\t\t\t\tif (event.detail.target.id !== \"history-sentinel\") {\n\t\t\t\t\t\treturn;\n\t\t\t\t\t}\n\n\t\t\t\t\tlet fromBottom = messageArea.scrollHeight - messageArea.scrollTop;\n\t\t\t\t\tsetTimeout(() => {\n\t\t\t\t\t\tmessageArea.scrollTop = messageArea.scrollHeight - fromBottom;\n\t\t\t\t\t});\n\t\t\t\t});\n\n        let initialLoad = false;\n        document.body.addEventListener(\"htmx:wsOpen\", () => {\n          initialLoad = true;\n        });\n\n        document.body.addEventListener(\"htmx:wsConnecting\", () => {\n          if (!initialLoad) {\n            return;\n          }\n\n          // Skip non-message elements such as rate limit warnings.\n          let messages = messageArea.querySelectorAll(\"[data-messageID]\");\n          let messageID = messages[messages.length - 1]?.getAttribute(\"data-messageID\");\n\n          if (!messageID) {\n            return\n          }\n\n          let url = new URL(messageArea.getAttribute(\"hx-get\"), window.location.origin);\n          url.searchParams.delete(\"around\");\n          url.searchParams.set(\"messageID\", messageID);\n\n          htmx.ajax(\"GET\", url.toString(), { target: \"#message-area\", swap: \"beforeend\" });\n        });\n\n        // Backfilled and live messages can overlap while reconnecting. Skip\n        // bubbles that are already rendered.\n        document.body.addEventListener(\"htmx:oobBeforeSwap\", (event) => {\n          if (event.detail.target.id !== \"message-area\") {\n            return;\n          }\n\n          let bubble = event.detail.fragment.querySelector(\"[data-messageID]\");\n          let messageID = bubble?.getAttribute(\"data-messageID\");\n          if (messageID && messageArea.querySelector(`[data-messageID=\"${messageID}\"]`)) {\n            event.detail.shouldSwap = false;\n          }\n        });\n\n        // Messages loaded in place of the load more marker may also have\n        // been received live while the marker was shown. Keep the copy in\n        // its place in the timeline.\n        document.body.addEventListener(\"htmx:afterSwap\", (event) => {\n          if (event.detail.target.id !== \"load-more-messages\") {\n            return;\n          }\n\n          let seen = new Set();\n          messageArea.querySelectorAll(\"[data-messageID]\").forEach((message) => {\n            let messageID = message.getAttribute(\"data-messageID\");\n            if (seen.has(messageID)) {\n              message.remove();\n            }\n            seen.add(messageID);\n          });\n        });\n\n        let typingTimer = null;        \n        document.body.addEventListener(\"htmx:oobAfterSwap\", (event) => {\n          if (event.detail.target.id === \"typing-indicator\") {\n            const indicator = event.detail.target;\n            if (indicator.innerHTML.trim() !== \"\") {\n               indicator.classList.remove(\"hidden\");\n               \n               clearTimeout(typingTimer);\n               typingTimer = setTimeout(() => {\n                 indicator.innerHTML = \"\";\n                 indicator.classList.add(\"hidden\");\n               }, 3000);\n            }\n          }\n        });\n\t\t\t</script></div>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
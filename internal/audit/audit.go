@@ -0,0 +1,96 @@
+// Package audit records security and moderation events to the audit_events
+// table.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/johndosdos/chatter/internal/auth"
+	"github.com/johndosdos/chatter/internal/database"
+	ratelimiter "github.com/johndosdos/chatter/internal/rate_limiter"
+)
+
+// Event names, as stored in the audit_events table.
+const (
+	EventLogin        = "login"
+	EventLoginFailed  = "login_failed"
+	EventSignup       = "signup"
+	EventLogout       = "logout"
+	EventTokenRefresh = "token_refresh"
+	EventRateLimited  = "rate_limited"
+
+	EventRoleChanged    = "role_changed"
+	EventKick           = "kick"
+	EventMute           = "mute"
+	EventBan            = "ban"
+	EventUnmute         = "unmute"
+	EventUnban          = "unban"
+	EventMessageDeleted = "message_deleted"
+	EventReport         = "report"
+	EventReportClosed   = "report_closed"
+)
+
+// Events lists every event name, for filtering.
+var Events = []string{
+	EventLogin, EventLoginFailed, EventSignup, EventLogout, EventTokenRefresh,
+	EventRateLimited, EventRoleChanged, EventKick, EventMute, EventBan,
+	EventUnmute, EventUnban, EventMessageDeleted, EventReport, EventReportClosed,
+}
+
+// Event is a single entry of the audit log. The actor is the user who
+// caused the event and the target the user it affected; either may be
+// unknown.
+type Event struct {
+	Name     string
+	ActorID  uuid.UUID
+	TargetID uuid.UUID
+	IP       string
+	Metadata map[string]any
+}
+
+// NewEvent returns an event caused by the request. The client's IP is
+// recorded, and the user found in the request context, if any, is the actor.
+func NewEvent(r *http.Request, name string) Event {
+	event := Event{
+		Name: name,
+		IP:   ratelimiter.ClientIP(r),
+	}
+	if userID, err := auth.GetUserFromContext(r.Context()); err == nil {
+		event.ActorID = userID
+	}
+
+	return event
+}
+
+// Record stores the event. Failing to do so is logged but never stops the
+// action being audited.
+func Record(ctx context.Context, db *database.Queries, event Event) {
+	metadata := []byte("{}")
+	if len(event.Metadata) > 0 {
+		var err error
+		metadata, err = json.Marshal(event.Metadata)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to encode audit event metadata",
+				"error", err,
+				"event", event.Name)
+			metadata = []byte("{}")
+		}
+	}
+
+	if err := db.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		Event:    event.Name,
+		ActorID:  pgtype.UUID{Bytes: event.ActorID, Valid: event.ActorID != uuid.Nil},
+		TargetID: pgtype.UUID{Bytes: event.TargetID, Valid: event.TargetID != uuid.Nil},
+		Ip:       event.IP,
+		Metadata: metadata,
+	}); err != nil {
+		slog.ErrorContext(ctx, "failed to record audit event",
+			"error", err,
+			"event", event.Name)
+	}
+}
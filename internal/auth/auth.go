@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/alexedwards/argon2id"
@@ -26,6 +27,29 @@ type ContextKey string
 // UserIDKey implements the ContextKey type.
 const UserIDKey ContextKey = "userId"
 
+// RoleKey implements the ContextKey type for passing the user's role.
+const RoleKey ContextKey = "role"
+
+// Role grants permissions to a user. Every role holds the permissions of
+// the roles below it.
+type Role string
+
+const (
+	RoleMember    Role = "member"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Roles lists every role, from the least to the most privileged.
+var Roles = []Role{RoleMember, RoleModerator, RoleAdmin}
+
+// AtLeast reports whether the role holds the permissions of the given role.
+// Unknown roles hold no permission.
+func (r Role) AtLeast(role Role) bool {
+	rank := slices.Index(Roles, r)
+	return rank >= 0 && rank >= slices.Index(Roles, role)
+}
+
 // HashPassword returns the hashed password created using the argon2id
 // package.
 func HashPassword(password string) (string, error) {
@@ -48,23 +72,35 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return isMatch, nil
 }
 
+// claims are the claims of our access tokens. Role is the user's role when
+// the token was issued: it only changes what is rendered, since privileged
+// actions check the current role.
+type claims struct {
+	jwt.RegisteredClaims
+	Role Role `json:"role,omitempty"`
+}
+
 // MakeJWT returns a JSON Web Token string to be used as an acess token
 // for client session.
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+func MakeJWT(userID uuid.UUID, role Role, tokenSecret string, expiresIn time.Duration) (string, error) {
 	now := time.Now().UTC()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Subject:   userID.String(),
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+		Role: role,
 	})
 
 	return token.SignedString([]byte(tokenSecret))
 }
 
 // ValidateJWT tries to validate the access token. It returns the user id
-// as a uuid.UUID type. The returned error is a uuid.Parse error.
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
+// as a uuid.UUID type, and the role the token was issued for. The returned
+// error is a uuid.Parse error.
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, Role, error) {
+	claims := &claims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		claims,
@@ -73,19 +109,19 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		jwt.WithExpirationRequired(),
 	)
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("internal/auth: failed to parse token: %w", err)
+		return uuid.UUID{}, "", fmt.Errorf("internal/auth: failed to parse token: %w", err)
 	}
 
 	if !token.Valid {
-		return uuid.UUID{}, errors.New("internal/auth: token is invalid")
+		return uuid.UUID{}, "", errors.New("internal/auth: token is invalid")
 	}
 
 	if claims.Subject == "" {
-		return uuid.UUID{}, errors.New("subject claim is missing")
+		return uuid.UUID{}, "", errors.New("subject claim is missing")
 	}
 
-	userid, _ := token.Claims.GetSubject()
-	return uuid.Parse(userid)
+	userid, err := uuid.Parse(claims.Subject)
+	return userid, claims.Role, err
 }
 
 // MakeRefreshToken returns a refresh token string, while also storing the
@@ -124,23 +160,39 @@ func GetUserFromContext(ctx context.Context) (uuid.UUID, error) {
 	return userID, nil
 }
 
+// GetRoleFromContext returns the user's role appended to the context by
+// the auth middleware, otherwise it returns an error.
+func GetRoleFromContext(ctx context.Context) (Role, error) {
+	role, ok := ctx.Value(RoleKey).(Role)
+	if !ok {
+		return "", errors.New("failed to assert RoleKey to Role")
+	}
+
+	return role, nil
+}
+
 // SetTokensAndCookies creates new JWTs and refresh tokens, and set the HTTP
-// response cookies.
+// response cookies. It returns the role the JWT was issued for.
 func SetTokensAndCookies(w http.ResponseWriter,
 	r *http.Request,
 	db *database.Queries,
 	userID uuid.UUID,
 	refreshTokenExp time.Duration,
-	jwtExp time.Duration) error {
+	jwtExp time.Duration) (Role, error) {
 	refreshToken, err := MakeRefreshToken(r.Context(),
 		db, userID, refreshTokenExp)
 	if err != nil {
-		return fmt.Errorf("internal/auth: failed to create refresh token: %v", err)
+		return "", fmt.Errorf("internal/auth: failed to create refresh token: %v", err)
+	}
+
+	role, err := db.GetUserRole(r.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return "", fmt.Errorf("internal/auth: failed to get user role: %v", err)
 	}
 
-	jwt, err := MakeJWT(userID, os.Getenv("JWT_SECRET"), jwtExp)
+	jwt, err := MakeJWT(userID, Role(role), os.Getenv("JWT_SECRET"), jwtExp)
 	if err != nil {
-		return fmt.Errorf("internal/auth: failed to make JWT: %v", err)
+		return "", fmt.Errorf("internal/auth: failed to make JWT: %v", err)
 	}
 
 	isProd := os.Getenv("APP_ENV") == "production"
@@ -181,5 +233,5 @@ func SetTokensAndCookies(w http.ResponseWriter,
 		Unparsed:    []string{},
 	})
 
-	return nil
+	return Role(role), nil
 }
@@ -86,28 +86,31 @@ func TestJWT(t *testing.T) {
 	t.Run("Valid_JWT", func(t *testing.T) {
 		userID := uuid.New()
 		expiration := 15 * time.Second
-		tokenString, err := MakeJWT(userID, tokenSecret, expiration)
+		tokenString, err := MakeJWT(userID, RoleMember, tokenSecret, expiration)
 		if err != nil {
 			t.Fatalf("MakeJWT() error = %+v", err)
 		}
-		gotUserID, err := ValidateJWT(tokenString, tokenSecret)
+		gotUserID, gotRole, err := ValidateJWT(tokenString, tokenSecret)
 		if err != nil {
 			t.Fatalf("ValidateJWT() error = %+v", err)
 		}
 		if gotUserID != userID {
 			t.Errorf("want = %+v, got = %+v", userID, gotUserID)
 		}
+		if gotRole != RoleMember {
+			t.Errorf("want = %+v, got = %+v", RoleMember, gotRole)
+		}
 	})
 
 	t.Run("Incorrect_secret", func(t *testing.T) {
 		userID := uuid.New()
 		expiration := 15 * time.Second
-		tokenString, err := MakeJWT(userID, tokenSecret, expiration)
+		tokenString, err := MakeJWT(userID, RoleMember, tokenSecret, expiration)
 		if err != nil {
 			t.Fatalf("MakeJWT() error = %+v", err)
 		}
 		fakeSecret := "fakesecret"
-		_, err = ValidateJWT(tokenString, fakeSecret)
+		_, _, err = ValidateJWT(tokenString, fakeSecret)
 		if err == nil {
 			t.Fatalf("ValidateJWT() error = %+v", err)
 		}
@@ -116,11 +119,11 @@ func TestJWT(t *testing.T) {
 	t.Run("Expired_token", func(t *testing.T) {
 		userID := uuid.New()
 		expiration := -1 * time.Second
-		tokenString, err := MakeJWT(userID, tokenSecret, expiration)
+		tokenString, err := MakeJWT(userID, RoleMember, tokenSecret, expiration)
 		if err != nil {
 			t.Fatalf("MakeJWT() error = %+v", err)
 		}
-		_, err = ValidateJWT(tokenString, tokenSecret)
+		_, _, err = ValidateJWT(tokenString, tokenSecret)
 		if err == nil {
 			t.Fatalf("ValidateJWT() error = %+v", err)
 		}
@@ -128,7 +131,7 @@ func TestJWT(t *testing.T) {
 
 	t.Run("Corrupt_token", func(t *testing.T) {
 		tokenString := "corrupttoken"
-		_, err := ValidateJWT(tokenString, tokenSecret)
+		_, _, err := ValidateJWT(tokenString, tokenSecret)
 		if err == nil {
 			t.Fatalf("ValidateJWT() error = %+v", err)
 		}
@@ -175,6 +178,31 @@ func TestGetUserFromContext(t *testing.T) {
 	})
 }
 
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		Name string
+		role Role
+		min  Role
+		want bool
+	}{
+		{"member_as_member", RoleMember, RoleMember, true},
+		{"member_as_moderator", RoleMember, RoleModerator, false},
+		{"moderator_as_member", RoleModerator, RoleMember, true},
+		{"moderator_as_admin", RoleModerator, RoleAdmin, false},
+		{"admin_as_moderator", RoleAdmin, RoleModerator, true},
+		{"unknown_role", Role("owner"), RoleMember, false},
+		{"empty_role", Role(""), RoleMember, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if got := tt.role.AtLeast(tt.min); got != tt.want {
+				t.Errorf("%q.AtLeast(%q) = %v, want %v", tt.role, tt.min, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMakeRefreshToken(t *testing.T) {
 	db, dbForGoose, migDir := testutil.DbInit()
 	testutil.DbGooseUp(dbForGoose, migDir)
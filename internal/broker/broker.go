@@ -0,0 +1,30 @@
+// Package broker fans out chat events between chatter instances, so users
+// connected to different replicas still see each other's messages, typing
+// indicators and presence.
+package broker
+
+import (
+	"context"
+	"errors"
+
+	"github.com/johndosdos/chatter/internal/model"
+)
+
+// ErrPayloadTooLarge is returned when an event is too large for the broker
+// to carry.
+var ErrPayloadTooLarge = errors.New("payload too large")
+
+// ErrSubscriberFull is returned when a subscriber is not keeping up and the
+// event could not be queued.
+var ErrSubscriberFull = errors.New("subscriber buffer is full")
+
+// Broker publishes chat events to every subscribed instance, including the
+// publishing instance itself.
+type Broker interface {
+	// Publish sends msg to every subscriber.
+	Publish(ctx context.Context, msg model.ChatMessage) error
+
+	// Subscribe returns a channel receiving every published event. The
+	// channel is closed once ctx is cancelled.
+	Subscribe(ctx context.Context) (<-chan model.ChatMessage, error)
+}
@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/johndosdos/chatter/internal/model"
+)
+
+// Memory is an in-process Broker. It is the default for single instance
+// deployments.
+type Memory struct {
+	mu   sync.Mutex
+	subs map[chan model.ChatMessage]struct{}
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		subs: make(map[chan model.ChatMessage]struct{}),
+	}
+}
+
+// Publish never blocks. The hub is usually both publisher and subscriber, so
+// waiting on a full subscriber would deadlock it.
+func (m *Memory) Publish(_ context.Context, msg model.ChatMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var err error
+	for sub := range m.subs {
+		select {
+		case sub <- msg:
+		default:
+			err = fmt.Errorf("internal/broker: %w", ErrSubscriberFull)
+		}
+	}
+
+	return err
+}
+
+func (m *Memory) Subscribe(ctx context.Context) (<-chan model.ChatMessage, error) {
+	sub := make(chan model.ChatMessage, 1024)
+
+	m.mu.Lock()
+	m.subs[sub] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		m.mu.Lock()
+		delete(m.subs, sub)
+		close(sub)
+		m.mu.Unlock()
+	}()
+
+	return sub, nil
+}
@@ -0,0 +1,81 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/johndosdos/chatter/internal/model"
+)
+
+func TestMemory(t *testing.T) {
+	t.Run("fan_out", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		b := NewMemory()
+		sub1, err := b.Subscribe(ctx)
+		if err != nil {
+			t.Fatalf("Subscribe() error = %+v", err)
+		}
+		sub2, err := b.Subscribe(ctx)
+		if err != nil {
+			t.Fatalf("Subscribe() error = %+v", err)
+		}
+
+		want := model.ChatMessage{ID: 1, Content: "hello", Type: "message"}
+		if err := b.Publish(ctx, want); err != nil {
+			t.Fatalf("Publish() error = %+v", err)
+		}
+
+		for _, sub := range []<-chan model.ChatMessage{sub1, sub2} {
+			select {
+			case got := <-sub:
+				if got.ID != want.ID || got.Content != want.Content {
+					t.Errorf("want %+v, got %+v", want, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("subscriber did not receive the payload")
+			}
+		}
+	})
+
+	t.Run("closed_on_cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		b := NewMemory()
+		sub, err := b.Subscribe(ctx)
+		if err != nil {
+			t.Fatalf("Subscribe() error = %+v", err)
+		}
+		cancel()
+
+		select {
+		case _, ok := <-sub:
+			if ok {
+				t.Error("subscription should be closed")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("subscription was not closed")
+		}
+	})
+
+	t.Run("full_subscriber", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		b := NewMemory()
+		if _, err := b.Subscribe(ctx); err != nil {
+			t.Fatalf("Subscribe() error = %+v", err)
+		}
+
+		var err error
+		for range 1025 {
+			err = b.Publish(ctx, model.ChatMessage{})
+		}
+		if !errors.Is(err, ErrSubscriberFull) {
+			t.Errorf("want %v, got %v", ErrSubscriberFull, err)
+		}
+	})
+}
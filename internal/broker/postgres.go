@@ -0,0 +1,289 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/johndosdos/chatter/internal/model"
+)
+
+// NotifyChannel is the PostgreSQL channel chatter instances LISTEN on.
+const NotifyChannel = "chatter_events"
+
+// NotifyChunkChannel carries the events too large for a single NOTIFY, split
+// into chunks.
+const NotifyChunkChannel = "chatter_event_chunks"
+
+// PostgreSQL rejects NOTIFY payloads of 8000 bytes or more.
+const maxNotifyPayload = 7999
+
+const (
+	// chunkSize is the part of an event carried by a chunk, leaving room for
+	// the base64 encoding and the rest of the chunk.
+	chunkSize = 5 << 10
+	// maxChunks caps the size of an event at 320 KiB.
+	maxChunks = 64
+	// chunkTimeout is how long the chunks of an event are kept waiting for
+	// the others, in case some were lost to a reconnection.
+	chunkTimeout = 30 * time.Second
+)
+
+// Postgres is a Broker built on PostgreSQL LISTEN/NOTIFY. Every instance
+// connected to the same database receives the events of every other
+// instance.
+type Postgres struct {
+	pool *pgxpool.Pool
+	// RetryInterval is the delay between reconnection attempts of the
+	// listening connection.
+	RetryInterval time.Duration
+}
+
+func NewPostgres(pool *pgxpool.Pool) *Postgres {
+	return &Postgres{
+		pool:          pool,
+		RetryInterval: 2 * time.Second,
+	}
+}
+
+func (p *Postgres) Publish(ctx context.Context, msg model.ChatMessage) error {
+	// Request headers are only relevant to the receiving instance.
+	msg.Headers = nil
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("internal/broker: failed to marshal payload: %w", err)
+	}
+	if len(payload) > maxNotifyPayload {
+		return p.publishChunks(ctx, payload)
+	}
+
+	if _, err := p.pool.Exec(ctx, "SELECT pg_notify($1, $2)", NotifyChannel, string(payload)); err != nil {
+		return fmt.Errorf("internal/broker: failed to notify: %w", err)
+	}
+
+	return nil
+}
+
+// publishChunks sends a large event as several chunks. They are sent in a
+// single transaction, so that they are delivered together or not at all.
+func (p *Postgres) publishChunks(ctx context.Context, payload []byte) error {
+	chunks, err := split(payload)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("internal/broker: failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	for _, c := range chunks {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return fmt.Errorf("internal/broker: failed to marshal chunk: %w", err)
+		}
+		if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", NotifyChunkChannel, string(data)); err != nil {
+			return fmt.Errorf("internal/broker: failed to notify: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("internal/broker: failed to commit chunks: %w", err)
+	}
+
+	return nil
+}
+
+// chunk is a part of an event too large for a single NOTIFY.
+type chunk struct {
+	// ID is shared by the chunks of an event.
+	ID    uuid.UUID `json:"id"`
+	Index int       `json:"index"`
+	Total int       `json:"total"`
+	Data  []byte    `json:"data"`
+}
+
+// split cuts an event into chunks.
+func split(payload []byte) ([]chunk, error) {
+	total := (len(payload) + chunkSize - 1) / chunkSize
+	if total > maxChunks {
+		return nil, fmt.Errorf("internal/broker: %d bytes: %w", len(payload), ErrPayloadTooLarge)
+	}
+
+	id := uuid.New()
+	chunks := make([]chunk, 0, total)
+	for i := range total {
+		end := min((i+1)*chunkSize, len(payload))
+		chunks = append(chunks, chunk{
+			ID:    id,
+			Index: i,
+			Total: total,
+			Data:  payload[i*chunkSize : end],
+		})
+	}
+
+	return chunks, nil
+}
+
+// assembler puts the chunks of events back together.
+type assembler struct {
+	events map[uuid.UUID]*partialEvent
+}
+
+type partialEvent struct {
+	parts    [][]byte
+	received int
+	started  time.Time
+}
+
+func newAssembler() *assembler {
+	return &assembler{events: make(map[uuid.UUID]*partialEvent)}
+}
+
+// add returns the whole event once its last chunk was added. Events that
+// stay incomplete for too long are dropped.
+func (a *assembler) add(c chunk, now time.Time) ([]byte, bool) {
+	for id, event := range a.events {
+		if now.Sub(event.started) > chunkTimeout {
+			slog.Warn("dropping incomplete broker payload",
+				slog.String("id", id.String()),
+				slog.Int("received", event.received),
+				slog.Int("total", len(event.parts)))
+			delete(a.events, id)
+		}
+	}
+
+	if c.Total < 1 || c.Total > maxChunks || c.Index < 0 || c.Index >= c.Total {
+		slog.Error("invalid broker payload chunk",
+			slog.Int("index", c.Index),
+			slog.Int("total", c.Total))
+		return nil, false
+	}
+
+	event, ok := a.events[c.ID]
+	if !ok {
+		event = &partialEvent{parts: make([][]byte, c.Total), started: now}
+		a.events[c.ID] = event
+	}
+	if len(event.parts) != c.Total || event.parts[c.Index] != nil {
+		return nil, false
+	}
+	event.parts[c.Index] = c.Data
+	event.received++
+	if event.received < c.Total {
+		return nil, false
+	}
+
+	delete(a.events, c.ID)
+	return bytes.Join(event.parts, nil), true
+}
+
+// Subscribe opens a dedicated connection outside of the pool; a pooled
+// connection that is LISTENing would be handed out to unrelated queries.
+// The connection is re-established whenever it fails until ctx is
+// cancelled.
+func (p *Postgres) Subscribe(ctx context.Context) (<-chan model.ChatMessage, error) {
+	conn, err := p.listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := make(chan model.ChatMessage, 1024)
+	go p.receive(ctx, conn, sub)
+
+	return sub, nil
+}
+
+func (p *Postgres) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.ConnectConfig(ctx, p.pool.Config().ConnConfig.Copy())
+	if err != nil {
+		return nil, fmt.Errorf("internal/broker: failed to connect: %w", err)
+	}
+
+	for _, channel := range []string{NotifyChannel, NotifyChunkChannel} {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			_ = conn.Close(ctx)
+			return nil, fmt.Errorf("internal/broker: failed to listen: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (p *Postgres) receive(ctx context.Context, conn *pgx.Conn, sub chan<- model.ChatMessage) {
+	defer close(sub)
+	defer func() {
+		if conn != nil {
+			_ = conn.Close(context.Background())
+		}
+	}()
+
+	chunks := newAssembler()
+	for {
+		if conn == nil {
+			// The chunks of events sent while we were disconnected are lost.
+			chunks = newAssembler()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(p.RetryInterval):
+			}
+
+			var err error
+			conn, err = p.listen(ctx)
+			if err != nil {
+				slog.Warn("broker reconnect failed", slog.Any("error", err))
+				continue
+			}
+			slog.Info("broker reconnected")
+		}
+
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// Events published while we are disconnected are lost.
+			slog.Warn("broker connection lost", slog.Any("error", err))
+			_ = conn.Close(context.Background())
+			conn = nil
+			continue
+		}
+
+		payload := []byte(n.Payload)
+		if n.Channel == NotifyChunkChannel {
+			var c chunk
+			if err := json.Unmarshal(payload, &c); err != nil {
+				slog.Error("failed to unmarshal broker payload chunk", slog.Any("error", err))
+				continue
+			}
+			var ok bool
+			if payload, ok = chunks.add(c, time.Now()); !ok {
+				continue
+			}
+		}
+
+		var msg model.ChatMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			slog.Error("failed to unmarshal broker payload", slog.Any("error", err))
+			continue
+		}
+
+		select {
+		case sub <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/johndosdos/chatter/internal/model"
+	"github.com/johndosdos/chatter/internal/testutil"
+	"github.com/joho/godotenv"
+)
+
+func TestChunks(t *testing.T) {
+	t.Run("reassembled", func(t *testing.T) {
+		payload := bytes.Repeat([]byte("0123456789"), 2*chunkSize/10+7)
+		chunks, err := split(payload)
+		if err != nil {
+			t.Fatalf("split() error = %+v", err)
+		}
+		if len(chunks) != 3 {
+			t.Fatalf("want 3 chunks, got %d", len(chunks))
+		}
+		for _, c := range chunks {
+			data, err := json.Marshal(c)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %+v", err)
+			}
+			if len(data) > maxNotifyPayload {
+				t.Errorf("want chunks of at most %d bytes, got %d", maxNotifyPayload, len(data))
+			}
+		}
+
+		// Chunks may arrive in any order, and more than once.
+		a := newAssembler()
+		now := time.Now()
+		for _, i := range []int{2, 0, 2} {
+			if _, ok := a.add(chunks[i], now); ok {
+				t.Fatalf("event complete after chunk %d", i)
+			}
+		}
+		got, ok := a.add(chunks[1], now)
+		if !ok {
+			t.Fatal("event incomplete after every chunk")
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("want the payload back, got %d bytes", len(got))
+		}
+	})
+
+	t.Run("too_large", func(t *testing.T) {
+		_, err := split(make([]byte, maxChunks*chunkSize+1))
+		if !errors.Is(err, ErrPayloadTooLarge) {
+			t.Errorf("want %v, got %v", ErrPayloadTooLarge, err)
+		}
+	})
+
+	t.Run("incomplete_dropped", func(t *testing.T) {
+		chunks, err := split(make([]byte, 2*chunkSize))
+		if err != nil {
+			t.Fatalf("split() error = %+v", err)
+		}
+
+		a := newAssembler()
+		now := time.Now()
+		a.add(chunks[0], now)
+		if _, ok := a.add(chunks[1], now.Add(2*chunkTimeout)); ok {
+			t.Error("want the expired event dropped")
+		}
+	})
+}
+
+func TestPostgres(t *testing.T) {
+	if err := godotenv.Load(filepath.Join(testutil.ProjectRoot(), ".env")); err != nil {
+		t.Logf("failed to load .env file: %+v", err)
+	}
+	testURL := os.Getenv("TEST_DB_URL")
+	if testURL == "" {
+		t.Skip("TEST_DB_URL environment variable is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, testURL)
+	if err != nil {
+		t.Fatalf("could not connect to the postgresql database: %v", err)
+	}
+	defer pool.Close()
+
+	b := NewPostgres(pool)
+	sub, err := b.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %+v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"small", "hello"},
+		// Larger than a single NOTIFY payload.
+		{"large", strings.Repeat("a", 3*maxNotifyPayload)},
+	}
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			want := model.ChatMessage{ID: int64(i + 1), Content: tc.content, Type: "message"}
+			if err := b.Publish(ctx, want); err != nil {
+				t.Fatalf("Publish() error = %+v", err)
+			}
+
+			select {
+			case got := <-sub:
+				if got.ID != want.ID || got.Content != want.Content {
+					t.Errorf("want message %d of %d bytes, got message %d of %d bytes",
+						want.ID, len(want.Content), got.ID, len(got.Content))
+				}
+			case <-ctx.Done():
+				t.Fatal("subscriber did not receive the payload")
+			}
+		})
+	}
+}
@@ -12,47 +12,379 @@ import (
 )
 
 const createMessage = `-- name: CreateMessage :one
-INSERT INTO messages (user_id, content, created_at)
-VALUES ($1, $2, $3)
-RETURNING id, user_id, content, created_at
+INSERT INTO messages (user_id, room_id, conversation_id, parent_id, content, created_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, user_id, content, created_at, room_id, conversation_id, edited_at, deleted_at, parent_id, search
 `
 
 type CreateMessageParams struct {
-	UserID    pgtype.UUID
-	Content   string
-	CreatedAt pgtype.Timestamptz
+	UserID         pgtype.UUID
+	RoomID         pgtype.Int8
+	ConversationID pgtype.Int8
+	ParentID       pgtype.Int8
+	Content        string
+	CreatedAt      pgtype.Timestamptz
 }
 
 func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error) {
-	row := q.db.QueryRow(ctx, createMessage, arg.UserID, arg.Content, arg.CreatedAt)
+	row := q.db.QueryRow(ctx, createMessage,
+		arg.UserID,
+		arg.RoomID,
+		arg.ConversationID,
+		arg.ParentID,
+		arg.Content,
+		arg.CreatedAt,
+	)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Content,
+		&i.CreatedAt,
+		&i.RoomID,
+		&i.ConversationID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentID,
+		&i.Search,
+	)
+	return i, err
+}
+
+const createMessages = `-- name: CreateMessages :many
+WITH batch AS MATERIALIZED (
+    SELECT nextval(pg_get_serial_sequence('messages', 'id')) AS id, b.*
+    FROM unnest(
+        $1::uuid[], $2::bigint[], $3::bigint[],
+        $4::bigint[], $5::text[], $6::timestamptz[]
+    ) WITH ORDINALITY AS b(user_id, room_id, conversation_id, parent_id, content, created_at, position)
+    ORDER BY b.position
+), inserted AS (
+    INSERT INTO messages (id, user_id, room_id, conversation_id, parent_id, content, created_at)
+    OVERRIDING SYSTEM VALUE
+    SELECT id, user_id, NULLIF(room_id, 0), NULLIF(conversation_id, 0), NULLIF(parent_id, 0), content, created_at
+    FROM batch
+    RETURNING id, created_at
+)
+SELECT batch.position, inserted.id, inserted.created_at
+FROM inserted
+JOIN batch ON batch.id = inserted.id
+`
+
+type CreateMessagesParams struct {
+	Users         []pgtype.UUID
+	Rooms         []int64
+	Conversations []int64
+	Parents       []int64
+	Contents      []string
+	Created       []pgtype.Timestamptz
+}
+
+type CreateMessagesRow struct {
+	Position  int64
+	ID        int64
+	CreatedAt pgtype.Timestamptz
+}
+
+func (q *Queries) CreateMessages(ctx context.Context, arg CreateMessagesParams) ([]CreateMessagesRow, error) {
+	rows, err := q.db.Query(ctx, createMessages,
+		arg.Users,
+		arg.Rooms,
+		arg.Conversations,
+		arg.Parents,
+		arg.Contents,
+		arg.Created,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CreateMessagesRow
+	for rows.Next() {
+		var i CreateMessagesRow
+		if err := rows.Scan(&i.Position, &i.ID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteMessage = `-- name: DeleteMessage :one
+UPDATE messages
+SET content = '', deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, user_id, content, created_at, room_id, conversation_id, edited_at, deleted_at, parent_id, search
+`
+
+func (q *Queries) DeleteMessage(ctx context.Context, id int64) (Message, error) {
+	row := q.db.QueryRow(ctx, deleteMessage, id)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Content,
+		&i.CreatedAt,
+		&i.RoomID,
+		&i.ConversationID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentID,
+		&i.Search,
+	)
+	return i, err
+}
+
+const getMessage = `-- name: GetMessage :one
+SELECT id, user_id, content, created_at, room_id, conversation_id, edited_at, deleted_at, parent_id, search FROM messages
+WHERE id = $1
+`
+
+func (q *Queries) GetMessage(ctx context.Context, id int64) (Message, error) {
+	row := q.db.QueryRow(ctx, getMessage, id)
 	var i Message
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
 		&i.Content,
 		&i.CreatedAt,
+		&i.RoomID,
+		&i.ConversationID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentID,
+		&i.Search,
+	)
+	return i, err
+}
+
+const getMessageChannel = `-- name: GetMessageChannel :one
+SELECT m.id, m.parent_id, r.name AS room_name, p.username AS peer_username
+FROM messages m
+LEFT JOIN rooms r ON m.room_id = r.id
+LEFT JOIN conversations c ON m.conversation_id = c.id
+LEFT JOIN users p ON p.user_id = CASE WHEN c.user_a = $1 THEN c.user_b ELSE c.user_a END
+WHERE m.id = $2
+AND (
+  EXISTS (
+    SELECT 1 FROM room_members rm
+    WHERE rm.room_id = m.room_id AND rm.user_id = $1
+  )
+  OR $1 IN (c.user_a, c.user_b)
+)
+`
+
+type GetMessageChannelParams struct {
+	UserID pgtype.UUID
+	ID     int64
+}
+
+type GetMessageChannelRow struct {
+	ID           int64
+	ParentID     pgtype.Int8
+	RoomName     pgtype.Text
+	PeerUsername pgtype.Text
+}
+
+func (q *Queries) GetMessageChannel(ctx context.Context, arg GetMessageChannelParams) (GetMessageChannelRow, error) {
+	row := q.db.QueryRow(ctx, getMessageChannel, arg.UserID, arg.ID)
+	var i GetMessageChannelRow
+	err := row.Scan(
+		&i.ID,
+		&i.ParentID,
+		&i.RoomName,
+		&i.PeerUsername,
 	)
 	return i, err
 }
 
+const listConversationMessages = `-- name: ListConversationMessages :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.conversation_id = $1 AND m.parent_id IS NULL
+ORDER BY m.id DESC
+LIMIT $2
+`
+
+type ListConversationMessagesParams struct {
+	ConversationID pgtype.Int8
+	Limit          int32
+}
+
+type ListConversationMessagesRow struct {
+	ID        int64
+	UserID    pgtype.UUID
+	Content   string
+	CreatedAt pgtype.Timestamptz
+	EditedAt  pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
+	Username  string
+}
+
+func (q *Queries) ListConversationMessages(ctx context.Context, arg ListConversationMessagesParams) ([]ListConversationMessagesRow, error) {
+	rows, err := q.db.Query(ctx, listConversationMessages, arg.ConversationID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListConversationMessagesRow
+	for rows.Next() {
+		var i ListConversationMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Content,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.Username,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationMessagesAfter = `-- name: ListConversationMessagesAfter :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.conversation_id = $1 AND m.id > $2 AND m.parent_id IS NULL
+ORDER BY m.id ASC
+LIMIT $3
+`
+
+type ListConversationMessagesAfterParams struct {
+	ConversationID pgtype.Int8
+	ID             int64
+	Limit          int32
+}
+
+type ListConversationMessagesAfterRow struct {
+	ID        int64
+	UserID    pgtype.UUID
+	Content   string
+	CreatedAt pgtype.Timestamptz
+	EditedAt  pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
+	Username  string
+}
+
+func (q *Queries) ListConversationMessagesAfter(ctx context.Context, arg ListConversationMessagesAfterParams) ([]ListConversationMessagesAfterRow, error) {
+	rows, err := q.db.Query(ctx, listConversationMessagesAfter, arg.ConversationID, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListConversationMessagesAfterRow
+	for rows.Next() {
+		var i ListConversationMessagesAfterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Content,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.Username,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationMessagesBefore = `-- name: ListConversationMessagesBefore :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.conversation_id = $1 AND m.id < $2 AND m.parent_id IS NULL
+ORDER BY m.id DESC
+LIMIT $3
+`
+
+type ListConversationMessagesBeforeParams struct {
+	ConversationID pgtype.Int8
+	ID             int64
+	Limit          int32
+}
+
+type ListConversationMessagesBeforeRow struct {
+	ID        int64
+	UserID    pgtype.UUID
+	Content   string
+	CreatedAt pgtype.Timestamptz
+	EditedAt  pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
+	Username  string
+}
+
+func (q *Queries) ListConversationMessagesBefore(ctx context.Context, arg ListConversationMessagesBeforeParams) ([]ListConversationMessagesBeforeRow, error) {
+	rows, err := q.db.Query(ctx, listConversationMessagesBefore, arg.ConversationID, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListConversationMessagesBeforeRow
+	for rows.Next() {
+		var i ListConversationMessagesBeforeRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Content,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.Username,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listMessages = `-- name: ListMessages :many
-SELECT m.id, m.user_id, m.content, m.created_at, u.username
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
 FROM messages m
 JOIN users u ON m.user_id = u.user_id
-ORDER BY m.created_at DESC
-LIMIT $1
+WHERE m.room_id = $1 AND m.parent_id IS NULL
+ORDER BY m.id DESC
+LIMIT $2
 `
 
+type ListMessagesParams struct {
+	RoomID pgtype.Int8
+	Limit  int32
+}
+
 type ListMessagesRow struct {
 	ID        int64
 	UserID    pgtype.UUID
 	Content   string
 	CreatedAt pgtype.Timestamptz
+	EditedAt  pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
 	Username  string
 }
 
-func (q *Queries) ListMessages(ctx context.Context, limit int32) ([]ListMessagesRow, error) {
-	rows, err := q.db.Query(ctx, listMessages, limit)
+func (q *Queries) ListMessages(ctx context.Context, arg ListMessagesParams) ([]ListMessagesRow, error) {
+	rows, err := q.db.Query(ctx, listMessages, arg.RoomID, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +397,286 @@ func (q *Queries) ListMessages(ctx context.Context, limit int32) ([]ListMessages
 			&i.UserID,
 			&i.Content,
 			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.Username,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesAfter = `-- name: ListMessagesAfter :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.room_id = $1 AND m.id > $2 AND m.parent_id IS NULL
+ORDER BY m.id ASC
+LIMIT $3
+`
+
+type ListMessagesAfterParams struct {
+	RoomID pgtype.Int8
+	ID     int64
+	Limit  int32
+}
+
+type ListMessagesAfterRow struct {
+	ID        int64
+	UserID    pgtype.UUID
+	Content   string
+	CreatedAt pgtype.Timestamptz
+	EditedAt  pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
+	Username  string
+}
+
+func (q *Queries) ListMessagesAfter(ctx context.Context, arg ListMessagesAfterParams) ([]ListMessagesAfterRow, error) {
+	rows, err := q.db.Query(ctx, listMessagesAfter, arg.RoomID, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListMessagesAfterRow
+	for rows.Next() {
+		var i ListMessagesAfterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Content,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.Username,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesAround = `-- name: ListMessagesAround :many
+SELECT id, user_id, content, created_at, edited_at, deleted_at, username
+FROM (
+  (
+    SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+    FROM messages m
+    JOIN users u ON m.user_id = u.user_id
+    WHERE (m.room_id = $1 OR m.conversation_id = $2)
+    AND m.id <= $3 AND m.parent_id IS NULL
+    ORDER BY m.id DESC
+    LIMIT $4
+  )
+  UNION ALL
+  (
+    SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+    FROM messages m
+    JOIN users u ON m.user_id = u.user_id
+    WHERE (m.room_id = $1 OR m.conversation_id = $2)
+    AND m.id > $3 AND m.parent_id IS NULL
+    ORDER BY m.id ASC
+    LIMIT $5
+  )
+) AS around
+ORDER BY id
+`
+
+type ListMessagesAroundParams struct {
+	RoomID         pgtype.Int8
+	ConversationID pgtype.Int8
+	ID             int64
+	BeforeLimit    int32
+	AfterLimit     int32
+}
+
+type ListMessagesAroundRow struct {
+	ID        int64
+	UserID    pgtype.UUID
+	Content   string
+	CreatedAt pgtype.Timestamptz
+	EditedAt  pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
+	Username  string
+}
+
+func (q *Queries) ListMessagesAround(ctx context.Context, arg ListMessagesAroundParams) ([]ListMessagesAroundRow, error) {
+	rows, err := q.db.Query(ctx, listMessagesAround,
+		arg.RoomID,
+		arg.ConversationID,
+		arg.ID,
+		arg.BeforeLimit,
+		arg.AfterLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListMessagesAroundRow
+	for rows.Next() {
+		var i ListMessagesAroundRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Content,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.Username,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesBefore = `-- name: ListMessagesBefore :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.room_id = $1 AND m.id < $2 AND m.parent_id IS NULL
+ORDER BY m.id DESC
+LIMIT $3
+`
+
+type ListMessagesBeforeParams struct {
+	RoomID pgtype.Int8
+	ID     int64
+	Limit  int32
+}
+
+type ListMessagesBeforeRow struct {
+	ID        int64
+	UserID    pgtype.UUID
+	Content   string
+	CreatedAt pgtype.Timestamptz
+	EditedAt  pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
+	Username  string
+}
+
+func (q *Queries) ListMessagesBefore(ctx context.Context, arg ListMessagesBeforeParams) ([]ListMessagesBeforeRow, error) {
+	rows, err := q.db.Query(ctx, listMessagesBefore, arg.RoomID, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListMessagesBeforeRow
+	for rows.Next() {
+		var i ListMessagesBeforeRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Content,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.Username,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listThread = `-- name: ListThread :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE (m.id = $1 OR (m.parent_id = $1 AND m.deleted_at IS NULL))
+AND m.room_id IS NOT DISTINCT FROM $2
+AND m.conversation_id IS NOT DISTINCT FROM $3
+ORDER BY m.id
+`
+
+type ListThreadParams struct {
+	ParentID       int64
+	RoomID         pgtype.Int8
+	ConversationID pgtype.Int8
+}
+
+type ListThreadRow struct {
+	ID        int64
+	UserID    pgtype.UUID
+	Content   string
+	CreatedAt pgtype.Timestamptz
+	EditedAt  pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
+	Username  string
+}
+
+func (q *Queries) ListThread(ctx context.Context, arg ListThreadParams) ([]ListThreadRow, error) {
+	rows, err := q.db.Query(ctx, listThread, arg.ParentID, arg.RoomID, arg.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListThreadRow
+	for rows.Next() {
+		var i ListThreadRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Content,
+			&i.CreatedAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.Username,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listThreadSummaries = `-- name: ListThreadSummaries :many
+SELECT DISTINCT ON (m.parent_id) m.parent_id, COUNT(*) OVER (PARTITION BY m.parent_id) AS replies, m.content, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.parent_id = ANY($1::bigint[]) AND m.deleted_at IS NULL
+ORDER BY m.parent_id, m.id DESC
+`
+
+type ListThreadSummariesRow struct {
+	ParentID pgtype.Int8
+	Replies  int64
+	Content  string
+	Username string
+}
+
+func (q *Queries) ListThreadSummaries(ctx context.Context, messages []int64) ([]ListThreadSummariesRow, error) {
+	rows, err := q.db.Query(ctx, listThreadSummaries, messages)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListThreadSummariesRow
+	for rows.Next() {
+		var i ListThreadSummariesRow
+		if err := rows.Scan(
+			&i.ParentID,
+			&i.Replies,
+			&i.Content,
 			&i.Username,
 		); err != nil {
 			return nil, err
@@ -76,3 +688,33 @@ func (q *Queries) ListMessages(ctx context.Context, limit int32) ([]ListMessages
 	}
 	return items, nil
 }
+
+const updateMessageContent = `-- name: UpdateMessageContent :one
+UPDATE messages
+SET content = $2, edited_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, user_id, content, created_at, room_id, conversation_id, edited_at, deleted_at, parent_id, search
+`
+
+type UpdateMessageContentParams struct {
+	ID      int64
+	Content string
+}
+
+func (q *Queries) UpdateMessageContent(ctx context.Context, arg UpdateMessageContentParams) (Message, error) {
+	row := q.db.QueryRow(ctx, updateMessageContent, arg.ID, arg.Content)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Content,
+		&i.CreatedAt,
+		&i.RoomID,
+		&i.ConversationID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ParentID,
+		&i.Search,
+	)
+	return i, err
+}
@@ -8,19 +8,75 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-type Message struct {
+type AuditEvent struct {
+	ID        int64
+	Event     string
+	ActorID   pgtype.UUID
+	TargetID  pgtype.UUID
+	Ip        string
+	Metadata  []byte
+	CreatedAt pgtype.Timestamptz
+}
+
+type Conversation struct {
 	ID        int64
+	UserA     pgtype.UUID
+	UserB     pgtype.UUID
+	CreatedAt pgtype.Timestamptz
+}
+
+type Message struct {
+	ID             int64
+	UserID         pgtype.UUID
+	Content        string
+	CreatedAt      pgtype.Timestamptz
+	RoomID         pgtype.Int8
+	ConversationID pgtype.Int8
+	EditedAt       pgtype.Timestamptz
+	DeletedAt      pgtype.Timestamptz
+	ParentID       pgtype.Int8
+	Search         interface{}
+}
+
+type MessageMention struct {
+	MessageID int64
+	UserID    pgtype.UUID
+}
+
+type MessageReaction struct {
+	MessageID int64
 	UserID    pgtype.UUID
-	Content   string
+	Emoji     string
 	CreatedAt pgtype.Timestamptz
 }
 
+type MessageReceipt struct {
+	MessageID   int64
+	UserID      pgtype.UUID
+	DeliveredAt pgtype.Timestamptz
+	ReadAt      pgtype.Timestamptz
+}
+
 type Password struct {
 	UserID         pgtype.UUID
 	HashedPassword string
 	CreatedAt      pgtype.Timestamptz
 }
 
+type PinnedMessage struct {
+	MessageID int64
+	PinnedBy  pgtype.UUID
+	PinnedAt  pgtype.Timestamptz
+}
+
+type ReadMarker struct {
+	UserID         pgtype.UUID
+	RoomID         pgtype.Int8
+	ConversationID pgtype.Int8
+	LastReadID     int64
+	UpdatedAt      pgtype.Timestamptz
+}
+
 type RefreshToken struct {
 	Token     string
 	UserID    pgtype.UUID
@@ -30,8 +86,45 @@ type RefreshToken struct {
 	Valid     pgtype.Bool
 }
 
-type User struct {
+type Report struct {
+	ID         int64
+	MessageID  int64
+	ReporterID pgtype.UUID
+	Reason     string
+	Status     string
+	CreatedAt  pgtype.Timestamptz
+	ResolvedBy pgtype.UUID
+	ResolvedAt pgtype.Timestamptz
+}
+
+type Room struct {
+	ID        int64
+	Name      string
+	CreatedBy pgtype.UUID
+	CreatedAt pgtype.Timestamptz
+}
+
+type RoomMember struct {
+	RoomID   int64
 	UserID   pgtype.UUID
-	Username string
-	Email    string
+	JoinedAt pgtype.Timestamptz
+}
+
+type Sanction struct {
+	ID        int64
+	UserID    pgtype.UUID
+	Kind      string
+	Reason    string
+	ActorID   pgtype.UUID
+	CreatedAt pgtype.Timestamptz
+	ExpiresAt pgtype.Timestamptz
+	RevokedAt pgtype.Timestamptz
+}
+
+type User struct {
+	UserID    pgtype.UUID
+	Username  string
+	Email     string
+	Role      string
+	CreatedAt pgtype.Timestamptz
 }
@@ -15,7 +15,7 @@ const createUser = `-- name: CreateUser :one
 INSERT INTO users (user_id, username, email)
 VALUES ($1, $2, $3)
 ON CONFLICT (user_id) DO NOTHING
-RETURNING user_id, username, email
+RETURNING user_id, username, email, role, created_at
 `
 
 type CreateUserParams struct {
@@ -27,24 +27,66 @@ type CreateUserParams struct {
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
 	row := q.db.QueryRow(ctx, createUser, arg.UserID, arg.Username, arg.Email)
 	var i User
-	err := row.Scan(&i.UserID, &i.Username, &i.Email)
+	err := row.Scan(
+		&i.UserID,
+		&i.Username,
+		&i.Email,
+		&i.Role,
+		&i.CreatedAt,
+	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT user_id, username, email FROM users
+SELECT user_id, username, email, role, created_at FROM users
 WHERE user_id = $1
 `
 
 func (q *Queries) GetUserById(ctx context.Context, userID pgtype.UUID) (User, error) {
 	row := q.db.QueryRow(ctx, getUserById, userID)
 	var i User
-	err := row.Scan(&i.UserID, &i.Username, &i.Email)
+	err := row.Scan(
+		&i.UserID,
+		&i.Username,
+		&i.Email,
+		&i.Role,
+		&i.CreatedAt,
+	)
 	return i, err
 }
 
+const getUserByUsername = `-- name: GetUserByUsername :one
+SELECT user_id, username, email, role, created_at FROM users
+WHERE username = $1
+`
+
+func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.Username,
+		&i.Email,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserRole = `-- name: GetUserRole :one
+SELECT role FROM users
+WHERE user_id = $1
+`
+
+func (q *Queries) GetUserRole(ctx context.Context, userID pgtype.UUID) (string, error) {
+	row := q.db.QueryRow(ctx, getUserRole, userID)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
 const getUserWithPasswordByEmail = `-- name: GetUserWithPasswordByEmail :one
-SELECT u.user_id, u.username, u.email, p.hashed_password
+SELECT u.user_id, u.username, u.email, u.role, u.created_at, p.hashed_password
 FROM users AS u
 JOIN passwords AS p ON u.user_id = p.user_id
 WHERE u.email = $1
@@ -54,6 +96,7 @@ type GetUserWithPasswordByEmailRow struct {
 	UserID         pgtype.UUID
 	Username       string
 	Email          string
+	Role           string
 	HashedPassword string
 }
 
@@ -64,7 +107,58 @@ func (q *Queries) GetUserWithPasswordByEmail(ctx context.Context, email string)
 		&i.UserID,
 		&i.Username,
 		&i.Email,
+		&i.Role,
 		&i.HashedPassword,
 	)
 	return i, err
 }
+
+const listUsers = `-- name: ListUsers :many
+SELECT user_id, username, email, role, created_at FROM users
+ORDER BY username
+`
+
+func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := q.db.Query(ctx, listUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Username,
+			&i.Email,
+			&i.Role,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserRole = `-- name: SetUserRole :execrows
+UPDATE users
+SET role = $2
+WHERE username = $1
+`
+
+type SetUserRoleParams struct {
+	Username string
+	Role     string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setUserRole, arg.Username, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
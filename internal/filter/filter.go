@@ -0,0 +1,227 @@
+// Package filter checks the content of incoming messages through an ordered
+// chain of filters. Each filter can rewrite a message, reject it with a
+// reason shown to its author, or flag it for moderation.
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// Message is a message going through the chain.
+type Message struct {
+	UserID  uuid.UUID
+	Content string
+}
+
+// Verdict is the outcome of a single filter.
+type Verdict struct {
+	// Content is the content of the message, rewritten or not.
+	Content string
+	// Reject is the reason shown to the author of a rejected message.
+	Reject string
+	// Flag is the reason a message is flagged for moderation.
+	Flag string
+}
+
+// Filter checks a message.
+type Filter interface {
+	Apply(ctx context.Context, msg Message) (Verdict, error)
+}
+
+// Result is the outcome of a chain.
+type Result struct {
+	Content string
+	// Reject is the reason shown to the author of a rejected message.
+	Reject string
+	// Flags holds the reasons the message was flagged for, one per filter.
+	Flags []string
+}
+
+// Chain applies its filters in order. Every filter sees the content
+// rewritten by the filters before it. The chain stops at the first
+// rejection.
+type Chain []Filter
+
+func (c Chain) Apply(ctx context.Context, msg Message) (Result, error) {
+	var result Result
+	for _, f := range c {
+		verdict, err := f.Apply(ctx, msg)
+		if err != nil {
+			return result, err
+		}
+		msg.Content = verdict.Content
+		if verdict.Flag != "" {
+			result.Flags = append(result.Flags, verdict.Flag)
+		}
+		if verdict.Reject != "" {
+			result.Reject = verdict.Reject
+			break
+		}
+	}
+	result.Content = msg.Content
+
+	return result, nil
+}
+
+// Default returns the chain used without a configuration file. It only
+// sanitizes the content.
+func Default() Chain {
+	return Chain{Sanitize(bluemonday.StrictPolicy())}
+}
+
+// Config lists the filters of a chain, in order.
+type Config struct {
+	Filters []FilterConfig `json:"filters"`
+}
+
+// FilterConfig configures a single filter. Type selects the filter and
+// Action what it does with a matching message; the other fields only apply
+// to some filters.
+type FilterConfig struct {
+	Type   string `json:"type"`
+	Action string `json:"action,omitempty"`
+	// Max is the longest message for max_length and the longest run of the
+	// same character for repeated_chars.
+	Max int `json:"max,omitempty"`
+	// Words is the blocklist of blocklist.
+	Words []string `json:"words,omitempty"`
+	// MinAccountAge is how old accounts must be to post links, such as
+	// "24h", for links.
+	MinAccountAge string `json:"min_account_age,omitempty"`
+}
+
+// Options holds what the filters need from the rest of the app.
+type Options struct {
+	// AccountCreated returns when the user signed up. It is required by the
+	// links filter.
+	AccountCreated func(ctx context.Context, userID uuid.UUID) (time.Time, error)
+}
+
+// Load reads the chain from a JSON configuration file.
+func Load(path string, opts Options) (Chain, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("internal/filter: failed to open config: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	return Parse(f, opts)
+}
+
+// Parse reads the chain from a JSON configuration. The chain must start by
+// sanitizing the content, since messages are rendered as HTML: the other
+// filters then only ever see and produce escaped text.
+func Parse(r io.Reader, opts Options) (Chain, error) {
+	var config Config
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("internal/filter: failed to decode config: %w", err)
+	}
+
+	if len(config.Filters) == 0 || config.Filters[0].Type != "sanitize" {
+		return nil, fmt.Errorf("internal/filter: the chain must start with a sanitize filter")
+	}
+
+	chain := make(Chain, 0, len(config.Filters))
+	for i, fc := range config.Filters {
+		f, err := newFilter(fc, opts)
+		if err != nil {
+			return nil, fmt.Errorf("internal/filter: filter %d (%s): %w", i, fc.Type, err)
+		}
+		chain = append(chain, f)
+	}
+
+	return chain, nil
+}
+
+func newFilter(fc FilterConfig, opts Options) (Filter, error) {
+	switch fc.Type {
+	case "sanitize":
+		return Sanitize(bluemonday.StrictPolicy()), nil
+
+	case "max_length":
+		action, err := parseAction(fc.Action, "truncate", Reject)
+		if err != nil {
+			return nil, err
+		}
+		if fc.Max <= 0 {
+			return nil, fmt.Errorf("max must be positive")
+		}
+		return MaxLength(fc.Max, action), nil
+
+	case "blocklist":
+		action, err := parseAction(fc.Action, "mask", Rewrite)
+		if err != nil {
+			return nil, err
+		}
+		if len(fc.Words) == 0 {
+			return nil, fmt.Errorf("no words")
+		}
+		return Blocklist(fc.Words, action), nil
+
+	case "links":
+		action, err := parseAction(fc.Action, "", Reject)
+		if err != nil {
+			return nil, err
+		}
+		minAge, err := time.ParseDuration(fc.MinAccountAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_account_age: %w", err)
+		}
+		if opts.AccountCreated == nil {
+			return nil, fmt.Errorf("account creation times are unavailable")
+		}
+		return Links(minAge, action, opts.AccountCreated), nil
+
+	case "repeated_chars":
+		action, err := parseAction(fc.Action, "collapse", Rewrite)
+		if err != nil {
+			return nil, err
+		}
+		if fc.Max <= 0 {
+			return nil, fmt.Errorf("max must be positive")
+		}
+		return RepeatedChars(fc.Max, action), nil
+	}
+
+	return nil, fmt.Errorf("unknown filter type")
+}
+
+// Action is what a filter does with a matching message.
+type Action int
+
+const (
+	// Rewrite changes the content of the message: blocklist masks the
+	// words, max_length truncates and repeated_chars collapses the runs.
+	Rewrite Action = iota
+	// Reject drops the message and tells its author why.
+	Reject
+	// Flag lets the message through and reports it to the moderators.
+	Flag
+)
+
+// parseAction parses the action of a filter. rewrite is the name the filter
+// gives to Rewrite, if it can rewrite at all.
+func parseAction(s, rewrite string, fallback Action) (Action, error) {
+	switch {
+	case s == "":
+		return fallback, nil
+	case s == "reject":
+		return Reject, nil
+	case s == "flag":
+		return Flag, nil
+	case rewrite != "" && s == rewrite:
+		return Rewrite, nil
+	}
+
+	return 0, fmt.Errorf("unknown action %q", s)
+}
@@ -0,0 +1,165 @@
+package filter
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestChain(t *testing.T) {
+	newUser := uuid.New()
+	oldUser := uuid.New()
+	opts := Options{
+		AccountCreated: func(_ context.Context, userID uuid.UUID) (time.Time, error) {
+			if userID == newUser {
+				return time.Now().Add(-time.Hour), nil
+			}
+			return time.Now().Add(-48 * time.Hour), nil
+		},
+	}
+
+	config := `{"filters": [
+		{"type": "sanitize"},
+		{"type": "max_length", "max": 20},
+		{"type": "blocklist", "words": ["darn"]},
+		{"type": "blocklist", "words": ["heck"], "action": "flag"},
+		{"type": "links", "min_account_age": "24h"},
+		{"type": "repeated_chars", "max": 4}
+	]}`
+	chain, err := Parse(strings.NewReader(config), opts)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		userID  uuid.UUID
+		content string
+		want    Result
+	}{
+		{"clean", oldUser, "hello", Result{Content: "hello"}},
+		{"sanitized", oldUser, "<b>hi</b>", Result{Content: "hi"}},
+		{"too long", oldUser, strings.Repeat("a b ", 6), Result{
+			Content: strings.Repeat("a b ", 6),
+			Reject:  "Longer than 20 characters.",
+		}},
+		{"masked", oldUser, "oh DARN it", Result{Content: "oh **** it"}},
+		{"word inside another", oldUser, "darned", Result{Content: "darned"}},
+		{"flagged", oldUser, "what the heck", Result{
+			Content: "what the heck",
+			Flags:   []string{"Contains a blocked word."},
+		}},
+		{"link from new account", newUser, "see www.example.com", Result{
+			Content: "see www.example.com",
+			Reject:  "Contains a link from a new account.",
+		}},
+		{"link from old account", oldUser, "see www.example.com", Result{Content: "see www.example.com"}},
+		{"repeated", oldUser, "nooooooo!!!!!", Result{Content: "noooo!!!!"}},
+		{"rewrites before rejecting", newUser, "darn http://x.io", Result{
+			Content: "**** http://x.io",
+			Reject:  "Contains a link from a new account.",
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := chain.Apply(context.Background(), Message{UserID: tc.userID, Content: tc.content})
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if got.Content != tc.want.Content || got.Reject != tc.want.Reject || !slices.Equal(got.Flags, tc.want.Flags) {
+				t.Errorf("Apply(%q) = %+v, want %+v", tc.content, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBlocklistBoundaries(t *testing.T) {
+	chain := Chain{Default()[0], Blocklist([]string{"c", "c++", "@admin", ":)", "don't"}, Rewrite)}
+
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"I like c++", "I like ***"},
+		{"c++, c, and c#", "***, *, and *#"},
+		{"ask @admin now", "ask ****** now"},
+		{"@admin!", "******!"},
+		{"mail@admin.io", "mail@admin.io"},
+		{"ok :)", "ok **"},
+		{":):)", "****"},
+		{"I don't care", "I ***** care"},
+		{"abc", "abc"},
+	}
+
+	for _, tc := range tests {
+		got, err := chain.Apply(context.Background(), Message{Content: tc.content})
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if got.Content != tc.want {
+			t.Errorf("Apply(%q) = %q, want %q", tc.content, got.Content, tc.want)
+		}
+	}
+}
+
+func TestMaxLengthEscaped(t *testing.T) {
+	chain := Chain{Default()[0], MaxLength(5, Rewrite)}
+
+	tests := []struct {
+		content string
+		want    string
+	}{
+		// Entities count as the character they stand for.
+		{"a & b", "a &amp; b"},
+		// Truncation never cuts an entity in half.
+		{"ab & cd", "ab &amp; "},
+		{"abcd> x", "abcd&gt;"},
+	}
+
+	for _, tc := range tests {
+		got, err := chain.Apply(context.Background(), Message{Content: tc.content})
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if got.Content != tc.want {
+			t.Errorf("Apply(%q) = %q, want %q", tc.content, got.Content, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	opts := Options{
+		AccountCreated: func(context.Context, uuid.UUID) (time.Time, error) {
+			return time.Now(), nil
+		},
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		opts   Options
+	}{
+		{"no sanitize", `{"filters": [{"type": "max_length", "max": 10}]}`, opts},
+		{"sanitize not first", `{"filters": [{"type": "max_length", "max": 10}, {"type": "sanitize"}]}`, opts},
+		{"no filters", `{"filters": []}`, opts},
+		{"unknown type", `{"filters": [{"type": "sanitize"}, {"type": "caps"}]}`, opts},
+		{"unknown action", `{"filters": [{"type": "sanitize"}, {"type": "blocklist", "words": ["x"], "action": "truncate"}]}`, opts},
+		{"links cannot rewrite", `{"filters": [{"type": "sanitize"}, {"type": "links", "min_account_age": "1h", "action": "mask"}]}`, opts},
+		{"missing max", `{"filters": [{"type": "sanitize"}, {"type": "repeated_chars"}]}`, opts},
+		{"unknown field", `{"filters": [{"type": "sanitize", "mode": "strict"}]}`, opts},
+		{"links without account age", `{"filters": [{"type": "sanitize"}, {"type": "links", "min_account_age": "1h"}]}`, Options{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tc.config), tc.opts); err == nil {
+				t.Errorf("Parse(%s) succeeded, want an error", tc.config)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package filter
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Sanitizer strips unsafe HTML from content.
+type Sanitizer interface {
+	Sanitize(s string) string
+}
+
+type sanitize struct {
+	sanitizer Sanitizer
+}
+
+// Sanitize rewrites the content with the sanitizer, to prevent XSS.
+func Sanitize(sanitizer Sanitizer) Filter {
+	return sanitize{sanitizer: sanitizer}
+}
+
+func (f sanitize) Apply(_ context.Context, msg Message) (Verdict, error) {
+	return Verdict{Content: f.sanitizer.Sanitize(msg.Content)}, nil
+}
+
+type maxLength struct {
+	max    int
+	action Action
+}
+
+// MaxLength matches messages longer than limit characters. Rewriting
+// truncates them.
+func MaxLength(limit int, action Action) Filter {
+	return maxLength{max: limit, action: action}
+}
+
+func (f maxLength) Apply(_ context.Context, msg Message) (Verdict, error) {
+	// The content is sanitized, so & and < are escaped. Count and cut the text
+	// the user typed, so that an entity is never cut in half.
+	text := html.UnescapeString(msg.Content)
+	if utf8.RuneCountInString(text) <= f.max {
+		return Verdict{Content: msg.Content}, nil
+	}
+
+	reason := fmt.Sprintf("Longer than %d characters.", f.max)
+	return verdict(msg, f.action, reason, func(string) string {
+		return html.EscapeString(string([]rune(text)[:f.max]))
+	}), nil
+}
+
+type blocklist struct {
+	pattern *regexp.Regexp
+	action  Action
+}
+
+// Blocklist matches messages containing any of the words, ignoring case.
+// Words only match on their own, between the ends of the message, spaces or
+// punctuation, so that "c++" and ":)" can be blocked too. Rewriting masks
+// the words.
+func Blocklist(words []string, action Action) Filter {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, regexp.QuoteMeta(word))
+	}
+	// The longest words come first, so that "c++" is not matched as "c".
+	slices.SortStableFunc(quoted, func(a, b string) int {
+		return cmp.Compare(len(b), len(a))
+	})
+	pattern := regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`)
+
+	return blocklist{pattern: pattern, action: action}
+}
+
+func (f blocklist) Apply(_ context.Context, msg Message) (Verdict, error) {
+	// The content is sanitized: match the text the user typed, so that
+	// "don't" is not hidden as "don&#39;t".
+	text := html.UnescapeString(msg.Content)
+	found := f.find(text)
+	if len(found) == 0 {
+		return Verdict{Content: msg.Content}, nil
+	}
+
+	return verdict(msg, f.action, "Contains a blocked word.", func(string) string {
+		var b strings.Builder
+		last := 0
+		for _, m := range found {
+			b.WriteString(text[last:m[0]])
+			b.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[m[0]:m[1]])))
+			last = m[1]
+		}
+		b.WriteString(text[last:])
+		return html.EscapeString(b.String())
+	}), nil
+}
+
+// find returns the blocked words of the text as byte ranges, skipping the
+// ones inside a longer word.
+func (f blocklist) find(text string) [][]int {
+	var found [][]int
+	for _, m := range f.pattern.FindAllStringIndex(text, -1) {
+		before, _ := utf8.DecodeLastRuneInString(text[:m[0]])
+		after, _ := utf8.DecodeRuneInString(text[m[1]:])
+		if isWordRune(before) || isWordRune(after) {
+			continue
+		}
+		found = append(found, m)
+	}
+
+	return found
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// linkPattern matches URLs and bare www. addresses.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+type links struct {
+	minAge         time.Duration
+	action         Action
+	accountCreated func(ctx context.Context, userID uuid.UUID) (time.Time, error)
+}
+
+// Links matches messages containing links sent by accounts younger than
+// minAge. Links cannot be rewritten.
+func Links(minAge time.Duration, action Action, accountCreated func(ctx context.Context, userID uuid.UUID) (time.Time, error)) Filter {
+	return links{minAge: minAge, action: action, accountCreated: accountCreated}
+}
+
+func (f links) Apply(ctx context.Context, msg Message) (Verdict, error) {
+	if !linkPattern.MatchString(msg.Content) {
+		return Verdict{Content: msg.Content}, nil
+	}
+
+	created, err := f.accountCreated(ctx, msg.UserID)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("internal/filter: failed to get account age: %w", err)
+	}
+	if time.Since(created) >= f.minAge {
+		return Verdict{Content: msg.Content}, nil
+	}
+
+	return verdict(msg, f.action, "Contains a link from a new account.", nil), nil
+}
+
+type repeatedChars struct {
+	max    int
+	action Action
+}
+
+// RepeatedChars matches messages repeating the same character more than
+// limit times in a row. Rewriting shortens the runs to limit characters.
+func RepeatedChars(limit int, action Action) Filter {
+	return repeatedChars{max: limit, action: action}
+}
+
+func (f repeatedChars) Apply(_ context.Context, msg Message) (Verdict, error) {
+	if f.collapse(msg.Content) == msg.Content {
+		return Verdict{Content: msg.Content}, nil
+	}
+
+	return verdict(msg, f.action, "Repeats the same character too many times.", f.collapse), nil
+}
+
+func (f repeatedChars) collapse(content string) string {
+	var b strings.Builder
+	var prev rune
+	run := 0
+	for _, r := range content {
+		if r == prev {
+			run++
+		} else {
+			prev, run = r, 1
+		}
+		if run <= f.max {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// verdict applies the action to a matching message. rewrite is nil for
+// filters that cannot rewrite.
+func verdict(msg Message, action Action, reason string, rewrite func(string) string) Verdict {
+	switch action {
+	case Reject:
+		return Verdict{Content: msg.Content, Reject: reason}
+	case Flag:
+		return Verdict{Content: msg.Content, Flag: reason}
+	}
+
+	if rewrite == nil {
+		return Verdict{Content: msg.Content}
+	}
+	return Verdict{Content: rewrite(msg.Content)}
+}
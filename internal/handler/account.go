@@ -9,6 +9,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 	viewAuth "github.com/johndosdos/chatter/components/auth"
+	"github.com/johndosdos/chatter/internal/audit"
 	"github.com/johndosdos/chatter/internal/auth"
 	"github.com/johndosdos/chatter/internal/database"
 )
@@ -36,8 +37,15 @@ func SubmitLoginForm(db *database.Queries) http.HandlerFunc {
 		email := r.PostFormValue("email")
 		password := r.PostFormValue("password")
 
+		// Failed logins are recorded with the submitted email, since the user
+		// may not exist.
+		failed := audit.NewEvent(r, audit.EventLoginFailed)
+		failed.Metadata = map[string]any{"email": email}
+
 		user, err := db.GetUserWithPasswordByEmail(ctx, email)
 		if err != nil {
+			failed.Metadata["reason"] = "unknown email"
+			audit.Record(ctx, db, failed)
 			if err := viewAuth.ErrorMsgAuth("Invalid email or password.").Render(ctx, w); err != nil {
 				log.Printf("failed to render component: %v", err)
 				return
@@ -52,22 +60,48 @@ func SubmitLoginForm(db *database.Queries) http.HandlerFunc {
 			log.Printf("cannot verify password — hash may be corrupted: %v", err)
 			return
 		}
+		failed.TargetID = user.UserID.Bytes
 		if !ok {
+			failed.Metadata["reason"] = "wrong password"
+			audit.Record(ctx, db, failed)
 			if err := viewAuth.ErrorMsgAuth("Invalid email or password.").Render(ctx, w); err != nil {
 				log.Printf("failed to render component: %v", err)
 			}
 			return
 		}
 
+		ban, banned, err := activeSanction(ctx, db, user.UserID.Bytes, sanctionBan)
+		if err != nil {
+			http.Error(w, "Server error.", http.StatusInternalServerError)
+			log.Printf("failed to get ban from db: %v", err)
+			return
+		}
+		if banned {
+			failed.Metadata["reason"] = "banned"
+			audit.Record(ctx, db, failed)
+			message := "This account is banned."
+			if ban.ExpiresAt.Valid {
+				message = "This account is banned until " + ban.ExpiresAt.Time.UTC().Format("Jan 2 15:04 MST") + "."
+			}
+			if err := viewAuth.ErrorMsgAuth(message).Render(ctx, w); err != nil {
+				log.Printf("failed to render component: %v", err)
+			}
+			return
+		}
+
 		refreshTokenExp := 7 * 24 * time.Hour
 		jwtExp := 5 * time.Minute
-		err = auth.SetTokensAndCookies(w, r, db,
+		_, err = auth.SetTokensAndCookies(w, r, db,
 			user.UserID.Bytes, refreshTokenExp, jwtExp)
 		if err != nil {
 			log.Printf("%v", err)
 			return
 		}
 
+		login := audit.NewEvent(r, audit.EventLogin)
+		login.ActorID = user.UserID.Bytes
+		audit.Record(ctx, db, login)
+
 		w.Header().Set("HX-Redirect", "/chat")
 		w.WriteHeader(http.StatusOK)
 
@@ -149,6 +183,23 @@ func SubmitSignupForm(db *database.Queries) http.HandlerFunc {
 			}
 		}
 
+		// New users start out as members of the default room. Failing to join
+		// is not fatal; the user can still join from the rooms page.
+		room, err := db.GetRoomByName(ctx, DefaultRoom)
+		if err == nil {
+			err = db.JoinRoom(ctx, database.JoinRoomParams{
+				RoomID: room.ID,
+				UserID: user.UserID,
+			})
+		}
+		if err != nil {
+			log.Printf("failed to join default room: %v", err)
+		}
+
+		signup := audit.NewEvent(r, audit.EventSignup)
+		signup.ActorID = user.UserID.Bytes
+		audit.Record(ctx, db, signup)
+
 		w.Header().Set("HX-Redirect", "/account/login")
 		w.WriteHeader(http.StatusOK)
 
@@ -165,6 +216,14 @@ func SubmitLogoutReq(db *database.Queries) http.HandlerFunc {
 
 		refreshTok, err := r.Cookie("refresh_token")
 		if err == nil {
+			// The logout route is public; the user is known from their refresh
+			// token.
+			logout := audit.NewEvent(r, audit.EventLogout)
+			if token, err := db.GetRefreshToken(ctx, refreshTok.Value); err == nil {
+				logout.ActorID = token.UserID.Bytes
+				audit.Record(ctx, db, logout)
+			}
+
 			err = db.RevokeRefreshToken(ctx, refreshTok.Value)
 			if err != nil {
 				log.Printf("failed to process token deletion: %v", err)
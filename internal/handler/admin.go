@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"log"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	viewAdmin "github.com/johndosdos/chatter/components/admin"
+	"github.com/johndosdos/chatter/internal/audit"
+	"github.com/johndosdos/chatter/internal/auth"
+	"github.com/johndosdos/chatter/internal/database"
+)
+
+// ServeAdminUsers lists every user along with their role.
+func ServeAdminUsers(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		rows, err := db.ListUsers(ctx)
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to list users: %v", err)
+			return
+		}
+
+		users := make([]viewAdmin.UserItem, 0, len(rows))
+		for _, row := range rows {
+			users = append(users, viewAdmin.UserItem{
+				Username: row.Username,
+				Email:    row.Email,
+				Role:     auth.Role(row.Role),
+				Self:     row.UserID.Bytes == userID,
+			})
+		}
+
+		if err := viewAdmin.UsersPage(users).Render(ctx, w); err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+	}
+}
+
+// SubmitUserRole changes the role of the {username} user. Admins cannot
+// change their own role, so there is always one admin left.
+func SubmitUserRole(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data.", http.StatusBadRequest)
+			log.Printf("failed to parse form values: %v", err)
+			return
+		}
+
+		role := auth.Role(r.PostFormValue("role"))
+		if !slices.Contains(auth.Roles, role) {
+			http.Error(w, "Invalid role.", http.StatusBadRequest)
+			return
+		}
+
+		user, err := db.GetUserByUsername(ctx, chi.URLParam(r, "username"))
+		if err != nil {
+			http.Error(w, "User not found.", http.StatusNotFound)
+			log.Printf("failed to retrieve user from db: %v", err)
+			return
+		}
+		if user.UserID.Bytes == userID {
+			http.Error(w, "You cannot change your own role.", http.StatusForbidden)
+			return
+		}
+
+		if _, err := db.SetUserRole(ctx, database.SetUserRoleParams{
+			Username: user.Username,
+			Role:     string(role),
+		}); err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to set user role: %v", err)
+			return
+		}
+
+		event := audit.NewEvent(r, audit.EventRoleChanged)
+		event.TargetID = user.UserID.Bytes
+		event.Metadata = map[string]any{"from": user.Role, "to": string(role)}
+		audit.Record(ctx, db, event)
+
+		item := viewAdmin.UserItem{
+			Username: user.Username,
+			Email:    user.Email,
+			Role:     role,
+		}
+		if err := viewAdmin.UserRow(item, "Saved").Render(ctx, w); err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+
+		slog.InfoContext(ctx, "user role changed",
+			slog.String("username", user.Username),
+			slog.String("role", string(role)),
+			slog.String("by", userID.String()))
+	}
+}
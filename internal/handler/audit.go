@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	viewAdmin "github.com/johndosdos/chatter/components/admin"
+	"github.com/johndosdos/chatter/internal/database"
+)
+
+const (
+	// auditLimit is the number of events listed on the audit log page.
+	auditLimit = 200
+
+	// auditExportLimit is the number of events exported at once.
+	auditExportLimit = 10000
+)
+
+// auditFilters reads the audit log filters from the request query.
+func auditFilters(r *http.Request, limit int32) (viewAdmin.AuditFilters, database.ListAuditEventsParams, error) {
+	query := r.URL.Query()
+	filters := viewAdmin.AuditFilters{
+		Event:    query.Get("event"),
+		Username: strings.TrimPrefix(strings.TrimSpace(query.Get("username")), "@"),
+		IP:       strings.TrimSpace(query.Get("ip")),
+		Since:    query.Get("since"),
+		Until:    query.Get("until"),
+	}
+	params := database.ListAuditEventsParams{
+		Event:       filters.Event,
+		Username:    filters.Username,
+		Ip:          filters.IP,
+		ResultLimit: limit,
+	}
+
+	var err error
+	params.Since, err = parseDate(filters.Since)
+	if err != nil {
+		return filters, params, err
+	}
+	params.Until, err = parseDate(filters.Until)
+	if err != nil {
+		return filters, params, err
+	}
+	// Include the whole day.
+	params.Until.Time = params.Until.Time.AddDate(0, 0, 1)
+
+	return filters, params, nil
+}
+
+// ServeAuditLog lists the latest audit events matching the filters.
+//
+// The filter form is submitted by HTMX, in which case only the events are
+// rendered. Loading the URL directly renders the whole page.
+func ServeAuditLog(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		filters, params, err := auditFilters(r, auditLimit)
+		if err != nil {
+			http.Error(w, "Invalid date.", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.ListAuditEvents(ctx, params)
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to list audit events: %v", err)
+			return
+		}
+
+		entries := make([]viewAdmin.AuditEntry, 0, len(rows))
+		for _, row := range rows {
+			entry := viewAdmin.AuditEntry{
+				Event:     row.Event,
+				Actor:     row.Actor.String,
+				Target:    row.Target.String,
+				IP:        row.Ip,
+				CreatedAt: row.CreatedAt.Time.UTC().Format(time.DateTime),
+			}
+			if metadata := string(row.Metadata); metadata != "{}" {
+				entry.Metadata = metadata
+			}
+			entries = append(entries, entry)
+		}
+
+		exportURL := "/admin/audit/export"
+		if r.URL.RawQuery != "" {
+			exportURL += "?" + r.URL.RawQuery
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+
+		if r.Header.Get("HX-Request") == "true" {
+			err = viewAdmin.AuditEvents(entries, exportURL).Render(ctx, w)
+		} else {
+			err = viewAdmin.AuditPage(filters, entries, exportURL).Render(ctx, w)
+		}
+		if err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+	}
+}
+
+// auditExport is an audit event as exported to JSON.
+type auditExport struct {
+	ID        int64           `json:"id"`
+	Event     string          `json:"event"`
+	Actor     string          `json:"actor,omitempty"`
+	Target    string          `json:"target,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ExportAuditLog downloads the audit events matching the filters as JSON,
+// latest first.
+func ExportAuditLog(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		_, params, err := auditFilters(r, auditExportLimit)
+		if err != nil {
+			http.Error(w, "Invalid date.", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.ListAuditEvents(ctx, params)
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to list audit events: %v", err)
+			return
+		}
+
+		events := make([]auditExport, 0, len(rows))
+		for _, row := range rows {
+			events = append(events, auditExport{
+				ID:        row.ID,
+				Event:     row.Event,
+				Actor:     row.Actor.String,
+				Target:    row.Target.String,
+				IP:        row.Ip,
+				Metadata:  row.Metadata,
+				CreatedAt: row.CreatedAt.Time.UTC(),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.json"`)
+		if err := json.NewEncoder(w).Encode(events); err != nil {
+			log.Printf("failed to encode audit events: %v", err)
+		}
+	}
+}
@@ -1,18 +1,84 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	viewChat "github.com/johndosdos/chatter/components/chat"
+	"github.com/johndosdos/chatter/internal/auth"
+	"github.com/johndosdos/chatter/internal/database"
 )
 
-// ServeChat handles the chat interface.
+// ServeChat handles the chat interface of the room resolved by
+// RoomMiddleware.
 func ServeChat() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		if err := viewChat.ChatLayout().Render(ctx, w); err != nil {
+		room, err := GetRoomFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		if err := viewChat.ChatLayout("# "+room.Name, "/chat/"+room.Name, 0).Render(ctx, w); err != nil {
+			log.Printf("failed to close connection: %v", err)
+			return
+		}
+	}
+}
+
+// ServePermalink handles the chat interface of the room or direct
+// conversation of the {id} message, loaded around it. Replies open the chat
+// around the message starting their thread.
+//
+// Messages of channels the current user has no access to are reported as
+// not found.
+func ServePermalink(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid message ID.", http.StatusBadRequest)
+			return
+		}
+
+		message, err := db.GetMessageChannel(ctx, database.GetMessageChannelParams{
+			UserID: pgtype.UUID{Bytes: userID, Valid: true},
+			ID:     id,
+		})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "Message not found.", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to retrieve message from db: %v", err)
+			return
+		}
+
+		if message.ParentID.Valid {
+			id = message.ParentID.Int64
+		}
+
+		title, path := "# "+message.RoomName.String, "/chat/"+message.RoomName.String
+		if !message.RoomName.Valid {
+			title, path = "@ "+message.PeerUsername.String, "/dm/"+message.PeerUsername.String
+		}
+
+		if err := viewChat.ChatLayout(title, path, id).Render(ctx, w); err != nil {
 			log.Printf("failed to close connection: %v", err)
 			return
 		}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	viewAuth "github.com/johndosdos/chatter/components/auth"
+	viewChat "github.com/johndosdos/chatter/components/chat"
+	"github.com/johndosdos/chatter/internal/auth"
+	"github.com/johndosdos/chatter/internal/database"
+)
+
+type conversationContextKey string
+
+const conversationKey conversationContextKey = "conversation"
+
+// conversationPair returns both user IDs in the canonical order the
+// conversations table expects.
+func conversationPair(a, b uuid.UUID) (pgtype.UUID, pgtype.UUID) {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+
+	return pgtype.UUID{Bytes: a, Valid: true}, pgtype.UUID{Bytes: b, Valid: true}
+}
+
+// ConversationMiddleware resolves the {username} URL parameter to the direct
+// conversation between the current user and that user. The conversation is
+// appended to the request context for the next handler.
+func ConversationMiddleware(db *database.Queries) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			userID, err := auth.GetUserFromContext(ctx)
+			if err != nil {
+				log.Printf("%v", err)
+				redirect(w, r, "/account/login")
+				return
+			}
+
+			peer, err := db.GetUserByUsername(ctx, chi.URLParam(r, "username"))
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					http.Error(w, "User not found.", http.StatusNotFound)
+					return
+				}
+				http.Error(w, "Database error.", http.StatusInternalServerError)
+				log.Printf("failed to retrieve user from db: %v", err)
+				return
+			}
+
+			userA, userB := conversationPair(userID, peer.UserID.Bytes)
+			conversation, err := db.GetConversationByUsers(ctx, database.GetConversationByUsersParams{
+				UserA: userA,
+				UserB: userB,
+			})
+			if err != nil {
+				if !errors.Is(err, pgx.ErrNoRows) {
+					log.Printf("failed to retrieve conversation from db: %v", err)
+				}
+				redirect(w, r, "/rooms")
+				return
+			}
+
+			r = r.WithContext(context.WithValue(ctx, conversationKey, conversation))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetConversationFromContext returns the conversation resolved by
+// ConversationMiddleware, otherwise it returns an error.
+func GetConversationFromContext(ctx context.Context) (database.Conversation, error) {
+	conversation, ok := ctx.Value(conversationKey).(database.Conversation)
+	if !ok {
+		return database.Conversation{}, errors.New("failed to assert conversationKey to database.Conversation")
+	}
+
+	return conversation, nil
+}
+
+// ServeConversation handles the chat interface of a direct conversation.
+func ServeConversation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		username := chi.URLParam(r, "username")
+		if err := viewChat.ChatLayout("@ "+username, "/dm/"+username, 0).Render(ctx, w); err != nil {
+			log.Printf("failed to close connection: %v", err)
+			return
+		}
+	}
+}
+
+// SubmitStartConversation starts a direct conversation with the user from
+// the submitted username, or reopens the existing one.
+func SubmitStartConversation(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data.", http.StatusBadRequest)
+			log.Printf("failed to parse form values: %v", err)
+			return
+		}
+
+		peer, err := db.GetUserByUsername(ctx, r.PostFormValue("username"))
+		if err != nil {
+			if err := viewAuth.ErrorMsgAuth("User not found.").Render(ctx, w); err != nil {
+				log.Printf("failed to render component: %v", err)
+			}
+			return
+		}
+
+		if peer.UserID.Bytes == userID {
+			if err := viewAuth.ErrorMsgAuth("You can't message yourself.").Render(ctx, w); err != nil {
+				log.Printf("failed to render component: %v", err)
+			}
+			return
+		}
+
+		userA, userB := conversationPair(userID, peer.UserID.Bytes)
+		_, err = db.GetOrCreateConversation(ctx, database.GetOrCreateConversationParams{
+			UserA: userA,
+			UserB: userB,
+		})
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to create conversation entry in database: %v", err)
+			return
+		}
+
+		w.Header().Set("HX-Redirect", "/dm/"+peer.Username)
+		w.WriteHeader(http.StatusOK)
+
+		slog.InfoContext(ctx, "conversation started",
+			slog.String("peer", peer.Username))
+	}
+}
@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/johndosdos/chatter/internal/database"
+	"github.com/johndosdos/chatter/internal/model"
+)
+
+// messageRow holds the columns shared by every message listing query.
+type messageRow struct {
+	ID        int64
+	UserID    pgtype.UUID
+	Content   string
+	CreatedAt pgtype.Timestamptz
+	EditedAt  pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
+	Username  string
+}
+
+// history loads the messages of a single room or direct conversation.
+// Exactly one of the IDs is set.
+type history struct {
+	db             *database.Queries
+	roomID         int64
+	conversationID int64
+}
+
+// historyFromContext returns the history of the room or conversation
+// resolved by RoomMiddleware or ConversationMiddleware.
+func historyFromContext(ctx context.Context, db *database.Queries) (history, error) {
+	if room, err := GetRoomFromContext(ctx); err == nil {
+		return history{db: db, roomID: room.ID}, nil
+	}
+
+	conversation, err := GetConversationFromContext(ctx)
+	if err != nil {
+		return history{}, err
+	}
+
+	return history{db: db, conversationID: conversation.ID}, nil
+}
+
+// latest returns the most recent messages in chronological order.
+func (h history) latest(ctx context.Context, limit int32) ([]model.ChatMessage, error) {
+	var rows []messageRow
+	if h.roomID != 0 {
+		dbRows, err := h.db.ListMessages(ctx, database.ListMessagesParams{
+			RoomID: pgtype.Int8{Int64: h.roomID, Valid: true},
+			Limit:  limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range dbRows {
+			rows = append(rows, messageRow(row))
+		}
+	} else {
+		dbRows, err := h.db.ListConversationMessages(ctx, database.ListConversationMessagesParams{
+			ConversationID: pgtype.Int8{Int64: h.conversationID, Valid: true},
+			Limit:          limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range dbRows {
+			rows = append(rows, messageRow(row))
+		}
+	}
+
+	// The queries return the newest messages first.
+	reverse(rows)
+
+	return h.toChatMessages(ctx, rows)
+}
+
+// after returns up to limit messages sent after the given message ID, in
+// chronological order.
+func (h history) after(ctx context.Context, id int64, limit int32) ([]model.ChatMessage, error) {
+	var rows []messageRow
+	if h.roomID != 0 {
+		dbRows, err := h.db.ListMessagesAfter(ctx, database.ListMessagesAfterParams{
+			RoomID: pgtype.Int8{Int64: h.roomID, Valid: true},
+			ID:     id,
+			Limit:  limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range dbRows {
+			rows = append(rows, messageRow(row))
+		}
+	} else {
+		dbRows, err := h.db.ListConversationMessagesAfter(ctx, database.ListConversationMessagesAfterParams{
+			ConversationID: pgtype.Int8{Int64: h.conversationID, Valid: true},
+			ID:             id,
+			Limit:          limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range dbRows {
+			rows = append(rows, messageRow(row))
+		}
+	}
+
+	return h.toChatMessages(ctx, rows)
+}
+
+// before returns up to limit messages sent before the given message ID, in
+// chronological order.
+func (h history) before(ctx context.Context, id int64, limit int32) ([]model.ChatMessage, error) {
+	var rows []messageRow
+	if h.roomID != 0 {
+		dbRows, err := h.db.ListMessagesBefore(ctx, database.ListMessagesBeforeParams{
+			RoomID: pgtype.Int8{Int64: h.roomID, Valid: true},
+			ID:     id,
+			Limit:  limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range dbRows {
+			rows = append(rows, messageRow(row))
+		}
+	} else {
+		dbRows, err := h.db.ListConversationMessagesBefore(ctx, database.ListConversationMessagesBeforeParams{
+			ConversationID: pgtype.Int8{Int64: h.conversationID, Valid: true},
+			ID:             id,
+			Limit:          limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range dbRows {
+			rows = append(rows, messageRow(row))
+		}
+	}
+
+	// The queries return the newest messages first.
+	reverse(rows)
+
+	return h.toChatMessages(ctx, rows)
+}
+
+// around returns up to limit messages sent up to and including the given
+// message ID, followed by up to limit messages sent after it, in
+// chronological order.
+func (h history) around(ctx context.Context, id int64, limit int32) ([]model.ChatMessage, error) {
+	dbRows, err := h.db.ListMessagesAround(ctx, database.ListMessagesAroundParams{
+		RoomID:         pgtype.Int8{Int64: h.roomID, Valid: h.roomID != 0},
+		ConversationID: pgtype.Int8{Int64: h.conversationID, Valid: h.conversationID != 0},
+		ID:             id,
+		BeforeLimit:    limit,
+		AfterLimit:     limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]messageRow, 0, len(dbRows))
+	for _, row := range dbRows {
+		rows = append(rows, messageRow(row))
+	}
+
+	return h.toChatMessages(ctx, rows)
+}
+
+// thread returns the message starting a thread followed by its replies, in
+// chronological order. Deleted replies are left out. It is empty when the
+// message does not start a thread in this room or conversation.
+func (h history) thread(ctx context.Context, parentID int64) ([]model.ChatMessage, error) {
+	dbRows, err := h.db.ListThread(ctx, database.ListThreadParams{
+		ParentID:       parentID,
+		RoomID:         pgtype.Int8{Int64: h.roomID, Valid: h.roomID != 0},
+		ConversationID: pgtype.Int8{Int64: h.conversationID, Valid: h.conversationID != 0},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]messageRow, 0, len(dbRows))
+	for _, row := range dbRows {
+		rows = append(rows, messageRow(row))
+	}
+
+	return h.toChatMessages(ctx, rows)
+}
+
+// lastRead returns the ID of the last message the user read, or zero.
+func (h history) lastRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	lastRead, err := h.db.GetReadMarker(ctx, database.GetReadMarkerParams{
+		UserID:         pgtype.UUID{Bytes: userID, Valid: true},
+		RoomID:         pgtype.Int8{Int64: h.roomID, Valid: h.roomID != 0},
+		ConversationID: pgtype.Int8{Int64: h.conversationID, Valid: h.conversationID != 0},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+
+	return lastRead, err
+}
+
+// unread counts the messages of other users sent after the given message.
+func (h history) unread(ctx context.Context, userID uuid.UUID, lastRead int64) (int, error) {
+	count, err := h.db.CountUnread(ctx, database.CountUnreadParams{
+		RoomID:         pgtype.Int8{Int64: h.roomID, Valid: h.roomID != 0},
+		ConversationID: pgtype.Int8{Int64: h.conversationID, Valid: h.conversationID != 0},
+		LastReadID:     lastRead,
+		UserID:         pgtype.UUID{Bytes: userID, Valid: true},
+	})
+
+	return int(count), err
+}
+
+// pins returns the pinned messages, latest first.
+func (h history) pins(ctx context.Context) ([]model.Pin, error) {
+	rows, err := h.db.ListPins(ctx, database.ListPinsParams{
+		RoomID:         pgtype.Int8{Int64: h.roomID, Valid: h.roomID != 0},
+		ConversationID: pgtype.Int8{Int64: h.conversationID, Valid: h.conversationID != 0},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pins := make([]model.Pin, 0, len(rows))
+	for _, row := range rows {
+		pins = append(pins, model.Pin{
+			MessageID: row.ID,
+			Username:  row.Username,
+			Content:   row.Content,
+		})
+	}
+
+	return pins, nil
+}
+
+func reverse(rows []messageRow) {
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+}
+
+// toChatMessages converts the rows and loads the reactions, mentions,
+// receipts and thread summaries of all of the messages at once.
+func (h history) toChatMessages(ctx context.Context, rows []messageRow) ([]model.ChatMessage, error) {
+	ids := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+
+	reactionRows, err := h.db.ListReactions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions := make(map[int64][]model.Reaction)
+	for _, row := range reactionRows {
+		userIDs := make([]uuid.UUID, 0, len(row.Users))
+		for _, user := range row.Users {
+			userIDs = append(userIDs, user.Bytes)
+		}
+		reactions[row.MessageID] = append(reactions[row.MessageID], model.Reaction{
+			Emoji:   row.Emoji,
+			UserIDs: userIDs,
+		})
+	}
+
+	mentionRows, err := h.db.ListMentions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	mentions := make(map[int64][]model.Mention)
+	for _, row := range mentionRows {
+		mentions[row.MessageID] = append(mentions[row.MessageID], model.Mention{
+			UserID:   row.UserID.Bytes,
+			Username: row.Username,
+		})
+	}
+
+	receiptRows, err := h.db.ListReceipts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	receipts := make(map[int64]model.Receipt)
+	for _, row := range receiptRows {
+		receipts[row.ID] = model.Receipt{
+			MessageID: row.ID,
+			SenderID:  row.UserID.Bytes,
+			Delivered: int(row.Delivered),
+			Seen:      int(row.Seen),
+		}
+	}
+
+	summaryRows, err := h.db.ListThreadSummaries(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	threads := make(map[int64]model.Thread)
+	for _, row := range summaryRows {
+		threads[row.ParentID.Int64] = model.Thread{
+			Replies:  int(row.Replies),
+			Username: row.Username,
+			Content:  row.Content,
+		}
+	}
+
+	messages := make([]model.ChatMessage, 0, len(rows))
+	for _, row := range rows {
+		messages = append(messages, model.ChatMessage{
+			ID:             row.ID,
+			RoomID:         h.roomID,
+			ConversationID: h.conversationID,
+			UserID:         row.UserID.Bytes,
+			Username:       row.Username,
+			Content:        row.Content,
+			CreatedAt:      row.CreatedAt.Time,
+			Edited:         row.EditedAt.Valid,
+			Deleted:        row.DeletedAt.Valid,
+			Reactions:      reactions[row.ID],
+			Mentions:       mentions[row.ID],
+			Receipt:        receipts[row.ID],
+			Thread:         threads[row.ID],
+		})
+	}
+
+	return messages, nil
+}
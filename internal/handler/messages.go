@@ -2,18 +2,46 @@ package handler
 
 import (
 	"context"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/a-h/templ"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/johndosdos/chatter/internal/auth"
 	"github.com/johndosdos/chatter/internal/database"
+	"github.com/johndosdos/chatter/internal/model"
 
 	viewChat "github.com/johndosdos/chatter/components/chat"
 )
 
-// ServeMessages handles client message rendering. It will load recent
-// chat history to current client.
+const (
+	// historyLimit is the number of messages loaded per page of history.
+	historyLimit = 50
+
+	// backfillLimit caps the number of missed messages sent to a reconnecting
+	// client at once. The rest is loaded on demand.
+	backfillLimit = 100
+)
+
+// ServeMessages handles client message rendering. It will load the recent
+// chat history of the room or direct conversation resolved by
+// RoomMiddleware or ConversationMiddleware to the current client.
+//
+// Reconnecting clients send the ID of the last message they have seen
+// through the messageID query parameter. Only the messages sent after it
+// are returned.
+//
+// Scrolling to the top of the chat sends the ID of the oldest rendered
+// message through the before query parameter. The page of messages sent
+// before it is returned.
+//
+// Permalinks send the ID of their message through the around query
+// parameter. The page of messages ending with it is returned, followed by
+// the messages sent after it, and the message is highlighted.
 func ServeMessages(db *database.Queries) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -25,40 +53,339 @@ func ServeMessages(db *database.Queries) http.HandlerFunc {
 			return
 		}
 
-		// Fetch latest 50 messages
-		dbMessageList, err := db.ListMessages(ctx, 50)
+		hist, err := historyFromContext(ctx, db)
 		if err != nil {
 			log.Printf("%v", err)
 			return
 		}
 
-		var prevMsg database.ListMessagesRow
+		w.Header().Set("Content-Type", "text/html")
+
+		if param := r.URL.Query().Get("messageID"); param != "" {
+			lastID, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid message ID.", http.StatusBadRequest)
+				return
+			}
+
+			// The last seen message is fetched too, so that the first missed
+			// message is grouped with it. Fetch one more than the cap to know
+			// if there is more to load.
+			messages, err := hist.after(ctx, lastID-1, backfillLimit+2)
+			if err != nil {
+				log.Printf("%v", err)
+				return
+			}
+
+			var prevMsg model.ChatMessage
+			if len(messages) > 0 && messages[0].ID == lastID {
+				prevMsg = messages[0]
+				messages = messages[1:]
+			}
+
+			hasMore := len(messages) > backfillLimit
+			if hasMore {
+				messages = messages[:backfillLimit]
+			}
+
+			// Reconnecting clients append the messages to the message area.
+			// The next batches replace the load more marker instead.
+			oob := r.Header.Get("HX-Target") != "load-more-messages"
+			view := messageView{
+				path:      strings.TrimSuffix(r.URL.Path, "/messages"),
+				userID:    userID,
+				oob:       oob,
+				moderator: isModerator(ctx),
+			}
+			if err := renderMessages(w, view, prevMsg, messages); err != nil {
+				log.Printf("failed to render component: %v", err)
+				return
+			}
+
+			if hasMore {
+				url := r.URL.Path + "?messageID=" + strconv.FormatInt(messages[len(messages)-1].ID, 10)
+				if err := viewChat.LoadMoreMessages(url, oob).Render(ctx, w); err != nil {
+					log.Printf("failed to render component: %v", err)
+				}
+			}
+			return
+		}
+
+		if param := r.URL.Query().Get("around"); param != "" {
+			id, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid message ID.", http.StatusBadRequest)
+				return
+			}
 
-		// Iterate in reverse to show oldest messages first (chronological order)
-		for i := len(dbMessageList) - 1; i >= 0; i-- {
-			message := dbMessageList[i]
+			// Both sides are fetched with one extra message: the older one is
+			// used by renderPage, the newer one tells if there is more to load.
+			messages, err := hist.around(ctx, id, historyLimit+1)
+			if err != nil {
+				log.Printf("%v", err)
+				return
+			}
 
-			// Check if current and previous messages have the same UserID.
-			sameUser := false
-			if message.UserID == prevMsg.UserID {
-				sameUser = true
+			split := len(messages)
+			for i, message := range messages {
+				if message.ID > id {
+					split = i
+					break
+				}
 			}
+			older, newer := messages[:split], messages[split:]
 
-			w.Header().Set("Content-Type", "text/html")
+			hasMore := len(newer) > historyLimit
+			if hasMore {
+				newer = newer[:historyLimit]
+			}
 
-			// Render message as sender or receiver.
-			var content templ.Component
-			if message.UserID.Bytes == userID {
-				content = viewChat.SenderBubble(message.Username, message.Content, sameUser, message.ID)
-			} else {
-				content = viewChat.ReceiverBubble(message.Username, message.Content, sameUser, message.ID)
+			view := messageView{
+				path:      strings.TrimSuffix(r.URL.Path, "/messages"),
+				userID:    userID,
+				target:    id,
+				moderator: isModerator(ctx),
 			}
-			if err := content.Render(context.Background(), w); err != nil {
+			if err := renderPage(ctx, w, r.URL.Path, view, older); err != nil {
 				log.Printf("failed to render component: %v", err)
 				return
 			}
 
-			prevMsg = message
+			var prevMsg model.ChatMessage
+			if len(older) > 0 {
+				prevMsg = older[len(older)-1]
+			}
+			if err := renderMessages(w, view, prevMsg, newer); err != nil {
+				log.Printf("failed to render component: %v", err)
+				return
+			}
+
+			if hasMore {
+				url := r.URL.Path + "?messageID=" + strconv.FormatInt(newer[len(newer)-1].ID, 10)
+				if err := viewChat.LoadMoreMessages(url, false).Render(ctx, w); err != nil {
+					log.Printf("failed to render component: %v", err)
+				}
+			}
+			return
+		}
+
+		// Every page is fetched with one extra, older message. See renderPage.
+		var messages []model.ChatMessage
+		if param := r.URL.Query().Get("before"); param != "" {
+			firstID, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid message ID.", http.StatusBadRequest)
+				return
+			}
+
+			messages, err = hist.before(ctx, firstID, historyLimit+1)
+			if err != nil {
+				log.Printf("%v", err)
+				return
+			}
+		} else {
+			messages, err = hist.latest(ctx, historyLimit+1)
+			if err != nil {
+				log.Printf("%v", err)
+				return
+			}
+		}
+
+		lastRead, err := hist.lastRead(ctx, userID)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		view := messageView{
+			path:      strings.TrimSuffix(r.URL.Path, "/messages"),
+			userID:    userID,
+			lastRead:  lastRead,
+			moderator: isModerator(ctx),
+		}
+		if err := renderPage(ctx, w, r.URL.Path, view, messages); err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+	}
+}
+
+// renderPage renders a page of history, preceded by a sentinel loading the
+// previous page when there is one.
+//
+// The page is expected to hold one extra message, older than the rendered
+// ones. Its presence tells that older messages remain, and it is used to
+// group the first rendered message with its sender's previous messages
+// across the page boundary.
+func renderPage(ctx context.Context, w io.Writer, path string, view messageView, messages []model.ChatMessage) error {
+	var prevMsg model.ChatMessage
+	if len(messages) > historyLimit {
+		prevMsg = messages[0]
+		messages = messages[1:]
+
+		url := path + "?before=" + strconv.FormatInt(messages[0].ID, 10)
+		if err := viewChat.HistorySentinel(url).Render(ctx, w); err != nil {
+			return err
+		}
+	}
+
+	return renderMessages(w, view, prevMsg, messages)
+}
+
+// messageView describes how renderMessages renders messages to a user.
+type messageView struct {
+	// path is the URL path of the room or conversation, used to link messages
+	// to their thread. It is empty for messages rendered in a thread pane.
+	path   string
+	userID uuid.UUID
+	// lastRead is the last message the user read. An unread divider is
+	// rendered before the messages following it. Zero renders none.
+	lastRead int64
+	// Out of band bubbles are appended to the message area wherever the
+	// response is swapped; the others are swapped into the request's target.
+	oob bool
+	// target is the message highlighted by a permalink, if any.
+	target int64
+	// moderator lets the user delete the messages of other users.
+	moderator bool
+}
+
+// isModerator reports whether the current user may moderate messages.
+func isModerator(ctx context.Context) bool {
+	role, err := auth.GetRoleFromContext(ctx)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+
+	return role.AtLeast(auth.RoleModerator)
+}
+
+// renderMessages renders messages in chronological order as sender or
+// receiver bubbles, grouping consecutive messages of the same user. prevMsg
+// is the message preceding the first one, if any.
+func renderMessages(w io.Writer, view messageView, prevMsg model.ChatMessage, messages []model.ChatMessage) error {
+	userID := view.userID
+	for _, message := range messages {
+		if view.lastRead > 0 && prevMsg.ID <= view.lastRead && message.ID > view.lastRead {
+			if err := viewChat.UnreadDivider().Render(context.Background(), w); err != nil {
+				return err
+			}
+		}
+
+		// Check if current and previous messages have the same UserID.
+		sameUser := message.UserID == prevMsg.UserID
+
+		msg := viewChat.Message{
+			ID:        message.ID,
+			Username:  message.Username,
+			Content:   message.Content,
+			SameUser:  sameUser,
+			Edited:    message.Edited,
+			Deleted:   message.Deleted,
+			Reactions: viewChat.Reactions(message.Reactions, userID),
+			Mentions:  viewChat.Mentioned(message.Mentions),
+			Target:    view.target != 0 && message.ID == view.target,
+			Moderator: view.moderator,
+		}
+		if view.path != "" {
+			msg.Thread = viewChat.NewThread(view.path, message.ID, message.Thread)
+			if message.UserID == userID {
+				msg.Receipt = &viewChat.Receipt{
+					Delivered: message.Receipt.Delivered,
+					Seen:      message.Receipt.Seen,
+				}
+			}
+		}
+
+		// Render message as sender or receiver.
+		var content templ.Component
+		switch {
+		case message.UserID == userID && view.oob:
+			content = viewChat.SenderBubble(msg)
+		case message.UserID == userID:
+			content = viewChat.SenderMessage(msg)
+		case view.oob:
+			content = viewChat.ReceiverBubble(msg)
+		default:
+			content = viewChat.ReceiverMessage(msg)
+		}
+		if err := content.Render(context.Background(), w); err != nil {
+			return err
+		}
+
+		prevMsg = message
+	}
+
+	return nil
+}
+
+// ServeThread renders the thread pane of a message, holding the message and
+// its replies.
+func ServeThread(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		hist, err := historyFromContext(ctx, db)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		parentID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid message ID.", http.StatusBadRequest)
+			return
+		}
+
+		messages, err := hist.thread(ctx, parentID)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+		if len(messages) == 0 {
+			http.Error(w, "Thread not found.", http.StatusNotFound)
+			return
+		}
+
+		replies := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+			view := messageView{userID: userID, moderator: isModerator(ctx)}
+			return renderMessages(w, view, model.ChatMessage{}, messages)
+		})
+
+		w.Header().Set("Content-Type", "text/html")
+		if err := viewChat.ThreadPane(parentID).Render(templ.WithChildren(ctx, replies), w); err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+	}
+}
+
+// ServePins renders the messages pinned to the room or conversation
+// resolved by RoomMiddleware or ConversationMiddleware.
+func ServePins(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		hist, err := historyFromContext(ctx, db)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		pins, err := hist.pins(ctx)
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to list pins: %v", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		if err := viewChat.PinnedMessages(pins).Render(ctx, w); err != nil {
+			log.Printf("failed to render component: %v", err)
 		}
 	}
 }
@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	viewAdmin "github.com/johndosdos/chatter/components/admin"
+	"github.com/johndosdos/chatter/internal/audit"
+	"github.com/johndosdos/chatter/internal/auth"
+	"github.com/johndosdos/chatter/internal/database"
+	ws "github.com/johndosdos/chatter/internal/websocket"
+)
+
+// Sanction kinds, as stored in the sanctions table.
+const (
+	sanctionKick = "kick"
+	sanctionMute = "mute"
+	sanctionBan  = "ban"
+)
+
+const (
+	// maxReasonLength caps the length of a sanction's reason.
+	maxReasonLength = 200
+
+	// maxSanctionDuration caps timed mutes and bans.
+	maxSanctionDuration = 30 * 24 * time.Hour
+)
+
+// activeSanction returns the user's mute or ban currently in effect, if any.
+func activeSanction(ctx context.Context, db *database.Queries, userID uuid.UUID, kind string) (database.Sanction, bool, error) {
+	sanction, err := db.GetActiveSanction(ctx, database.GetActiveSanctionParams{
+		UserID: pgtype.UUID{Bytes: userID, Valid: true},
+		Kind:   kind,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sanction, false, nil
+	}
+	if err != nil {
+		return sanction, false, err
+	}
+
+	return sanction, true, nil
+}
+
+// ServeModeration lists every user along with their active sanctions.
+func ServeModeration(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		role, err := auth.GetRoleFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		rows, err := db.ListUsers(ctx)
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to list users: %v", err)
+			return
+		}
+
+		sanctions, err := db.ListActiveSanctions(ctx)
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to list sanctions: %v", err)
+			return
+		}
+
+		users := make([]viewAdmin.ModerationItem, 0, len(rows))
+		for _, row := range rows {
+			item := viewAdmin.ModerationItem{
+				Username:   row.Username,
+				Role:       auth.Role(row.Role),
+				Manageable: !auth.Role(row.Role).AtLeast(role),
+			}
+			for _, sanction := range sanctions {
+				if sanction.UserID != row.UserID {
+					continue
+				}
+				markSanction(&item, sanction)
+			}
+			users = append(users, item)
+		}
+
+		if err := viewAdmin.ModerationPage(users).Render(ctx, w); err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+	}
+}
+
+// markSanction marks the item with the sanction. Permanent and longer
+// sanctions win over shorter ones.
+func markSanction(item *viewAdmin.ModerationItem, sanction database.Sanction) {
+	until := sanction.ExpiresAt.Time
+	switch sanction.Kind {
+	case sanctionMute:
+		if !item.Muted || until.After(item.MutedUntil) {
+			item.Muted = true
+			item.MutedUntil = until
+		}
+	case sanctionBan:
+		if !item.Banned || (!item.BannedUntil.IsZero() && (until.IsZero() || until.After(item.BannedUntil))) {
+			item.Banned = true
+			item.BannedUntil = until
+		}
+	}
+}
+
+// SubmitSanction applies the {action} to the {username} user: kick, mute,
+// ban, unmute or unban. Moderators can only sanction users holding a lower
+// role than theirs.
+func SubmitSanction(hub *ws.Hub, db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		actorID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+		actorRole, err := auth.GetRoleFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data.", http.StatusBadRequest)
+			log.Printf("failed to parse form values: %v", err)
+			return
+		}
+
+		reason := strings.TrimSpace(r.PostFormValue("reason"))
+		if len(reason) > maxReasonLength {
+			http.Error(w, "Reason is too long.", http.StatusBadRequest)
+			return
+		}
+
+		user, err := db.GetUserByUsername(ctx, chi.URLParam(r, "username"))
+		if err != nil {
+			http.Error(w, "User not found.", http.StatusNotFound)
+			log.Printf("failed to retrieve user from db: %v", err)
+			return
+		}
+		if auth.Role(user.Role).AtLeast(actorRole) {
+			http.Error(w, "You cannot moderate this user.", http.StatusForbidden)
+			return
+		}
+
+		action := chi.URLParam(r, "action")
+		expiresAt, err := sanctionExpiry(action, r.PostFormValue("duration"))
+		if err != nil {
+			http.Error(w, "Invalid duration.", http.StatusBadRequest)
+			return
+		}
+
+		message, err := sanctionUser(r, hub, db, actorID, user, action, reason, expiresAt)
+		if errors.Is(err, errInvalidAction) {
+			http.Error(w, "Invalid action.", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to %s user: %v", action, err)
+			return
+		}
+
+		item := viewAdmin.ModerationItem{
+			Username:   user.Username,
+			Role:       auth.Role(user.Role),
+			Manageable: true,
+		}
+		for _, kind := range []string{sanctionMute, sanctionBan} {
+			sanction, ok, err := activeSanction(ctx, db, user.UserID.Bytes, kind)
+			if err != nil {
+				log.Printf("failed to get sanction: %v", err)
+			}
+			if ok {
+				markSanction(&item, sanction)
+			}
+		}
+		if err := viewAdmin.ModerationRow(item, message).Render(ctx, w); err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+
+		slog.InfoContext(ctx, "user moderated",
+			slog.String("username", user.Username),
+			slog.String("action", action),
+			slog.String("reason", reason),
+			slog.String("by", actorID.String()))
+	}
+}
+
+var errInvalidAction = errors.New("invalid moderation action")
+
+// sanctionExpiry returns when a sanction applied by the action ends. Kicks
+// take effect immediately; mutes and bans need a duration. Only bans can be
+// permanent.
+func sanctionExpiry(action, duration string) (pgtype.Timestamptz, error) {
+	if action != sanctionMute && action != sanctionBan {
+		return pgtype.Timestamptz{}, nil
+	}
+	if duration == "permanent" && action == sanctionBan {
+		return pgtype.Timestamptz{}, nil
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return pgtype.Timestamptz{}, err
+	}
+	if d <= 0 || d > maxSanctionDuration {
+		return pgtype.Timestamptz{}, fmt.Errorf("duration %s out of range", d)
+	}
+
+	return pgtype.Timestamptz{Time: time.Now().UTC().Add(d), Valid: true}, nil
+}
+
+// sanctionUser applies the action to the user on behalf of the actor: kick,
+// mute, ban, unmute or unban. It returns the outcome to show the moderator.
+//
+// The action is recorded to the audit log as an event of the same name.
+func sanctionUser(r *http.Request, hub *ws.Hub, db *database.Queries, actorID uuid.UUID, user database.User, action, reason string, expiresAt pgtype.Timestamptz) (string, error) {
+	ctx := r.Context()
+	userID := uuid.UUID(user.UserID.Bytes)
+
+	event := audit.NewEvent(r, action)
+	event.ActorID = actorID
+	event.TargetID = userID
+	event.Metadata = map[string]any{"reason": reason}
+	if expiresAt.Valid {
+		event.Metadata["expires_at"] = expiresAt.Time
+	}
+
+	switch action {
+	case sanctionKick, sanctionMute, sanctionBan:
+		var err error
+		if action == sanctionKick {
+			_, err = db.CreateSanction(ctx, database.CreateSanctionParams{
+				UserID:    user.UserID,
+				Kind:      action,
+				Reason:    reason,
+				ActorID:   pgtype.UUID{Bytes: actorID, Valid: true},
+				ExpiresAt: expiresAt,
+			})
+		} else {
+			// A new mute or ban replaces the one in effect. Both happen in a
+			// single statement, so a failure leaves the old one in effect.
+			_, err = db.ReplaceSanction(ctx, database.ReplaceSanctionParams{
+				UserID:    user.UserID,
+				Kind:      action,
+				Reason:    reason,
+				ActorID:   pgtype.UUID{Bytes: actorID, Valid: true},
+				ExpiresAt: expiresAt,
+			})
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch action {
+		case sanctionKick:
+			kick(ctx, hub, userID, sanctionNotice("You have been removed from the chat.", reason))
+			audit.Record(ctx, db, event)
+			return "Kicked", nil
+		case sanctionMute:
+			mute(ctx, hub, userID, expiresAt.Time, reason)
+			audit.Record(ctx, db, event)
+			return "Muted", nil
+		default:
+			// Banned users are logged out everywhere once their access token
+			// expires, and cannot log in again.
+			if err := db.RevokeUserRefreshTokens(ctx, user.UserID); err != nil {
+				return "", err
+			}
+			kick(ctx, hub, userID, sanctionNotice("You have been banned.", reason))
+			audit.Record(ctx, db, event)
+			return "Banned", nil
+		}
+
+	case "unmute", "unban":
+		kind := strings.TrimPrefix(action, "un")
+		if _, err := db.RevokeSanctions(ctx, database.RevokeSanctionsParams{
+			UserID: user.UserID,
+			Kind:   kind,
+		}); err != nil {
+			return "", err
+		}
+		if kind == sanctionMute {
+			mute(ctx, hub, userID, time.Time{}, "")
+		}
+		audit.Record(ctx, db, event)
+		return "Lifted", nil
+	}
+
+	return "", errInvalidAction
+}
+
+// kick disconnects the user. The sanction is already stored, so a busy hub
+// only delays it: it applies once the user reconnects.
+func kick(ctx context.Context, hub *ws.Hub, userID uuid.UUID, reason string) {
+	if err := hub.Kick(ctx, userID, reason); err != nil {
+		slog.WarnContext(ctx, "failed to kick user",
+			"error", err,
+			"user_id", userID.String())
+	}
+}
+
+// mute mutes the connected user. Like kick, it only delays a stored
+// sanction when it fails.
+func mute(ctx context.Context, hub *ws.Hub, userID uuid.UUID, until time.Time, reason string) {
+	if err := hub.Mute(ctx, userID, until, reason); err != nil {
+		slog.WarnContext(ctx, "failed to mute user",
+			"error", err,
+			"user_id", userID.String())
+	}
+}
+
+// sanctionNotice appends the reason of a sanction, if any, to the notice
+// shown to the user.
+func sanctionNotice(notice, reason string) string {
+	if reason == "" {
+		return notice
+	}
+	return notice + " Reason: " + reason
+}
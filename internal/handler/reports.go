@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	viewAdmin "github.com/johndosdos/chatter/components/admin"
+	"github.com/johndosdos/chatter/components/chat"
+	"github.com/johndosdos/chatter/internal/audit"
+	"github.com/johndosdos/chatter/internal/auth"
+	"github.com/johndosdos/chatter/internal/database"
+	"github.com/johndosdos/chatter/internal/model"
+	ws "github.com/johndosdos/chatter/internal/websocket"
+)
+
+// Report statuses, as stored in the reports table.
+const (
+	reportResolved  = "resolved"
+	reportDismissed = "dismissed"
+)
+
+// reportContext is the number of messages shown before and after a reported
+// message.
+const reportContext = 3
+
+// SubmitReport reports a message of another user to the moderators. The
+// reason comes from the HX-Prompt header.
+func SubmitReport(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data.", http.StatusBadRequest)
+			log.Printf("failed to parse form values: %v", err)
+			return
+		}
+
+		messageID, err := strconv.ParseInt(r.PostFormValue("message_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid message.", http.StatusBadRequest)
+			return
+		}
+
+		reason := strings.TrimSpace(r.Header.Get("HX-Prompt"))
+		if reason == "" || len(reason) > maxReasonLength {
+			http.Error(w, "A reason of up to 200 characters is required.", http.StatusBadRequest)
+			return
+		}
+
+		// Users can only report the messages they can read.
+		if _, err := db.GetMessageChannel(ctx, database.GetMessageChannelParams{
+			UserID: pgtype.UUID{Bytes: userID, Valid: true},
+			ID:     messageID,
+		}); err != nil {
+			http.Error(w, "Message not found.", http.StatusNotFound)
+			log.Printf("failed to retrieve message channel from db: %v", err)
+			return
+		}
+		message, err := db.GetMessage(ctx, messageID)
+		if err != nil {
+			http.Error(w, "Message not found.", http.StatusNotFound)
+			log.Printf("failed to retrieve message from db: %v", err)
+			return
+		}
+		if message.UserID.Bytes == userID || message.DeletedAt.Valid {
+			http.Error(w, "You cannot report this message.", http.StatusForbidden)
+			return
+		}
+
+		if _, err := db.CreateReport(ctx, database.CreateReportParams{
+			MessageID:  messageID,
+			ReporterID: pgtype.UUID{Bytes: userID, Valid: true},
+			Reason:     reason,
+		}); err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to store report: %v", err)
+			return
+		}
+
+		event := audit.NewEvent(r, audit.EventReport)
+		event.TargetID = message.UserID.Bytes
+		event.Metadata = map[string]any{"message_id": messageID, "reason": reason}
+		audit.Record(ctx, db, event)
+
+		if err := chat.Reported().Render(ctx, w); err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+
+		slog.InfoContext(ctx, "message reported",
+			slog.Int64("message_id", messageID),
+			slog.String("by", userID.String()))
+	}
+}
+
+// ServeReports lists the reported messages with open reports, in the order
+// they were first reported.
+func ServeReports(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		role, err := auth.GetRoleFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		rows, err := db.ListOpenReports(ctx)
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to list reports: %v", err)
+			return
+		}
+
+		// Reports of the same message are grouped together.
+		var reports []viewAdmin.ReportItem
+		index := make(map[int64]int)
+		for _, row := range rows {
+			i, ok := index[row.MessageID]
+			if !ok {
+				item, err := reportItem(ctx, db, row)
+				if err != nil {
+					http.Error(w, "Database error.", http.StatusInternalServerError)
+					log.Printf("failed to get context of message %d: %v", row.MessageID, err)
+					return
+				}
+				item.Bannable = !auth.Role(row.AuthorRole).AtLeast(role)
+				i = len(reports)
+				index[row.MessageID] = i
+				reports = append(reports, item)
+			}
+			// Messages flagged by a content filter have no reporter.
+			reporter := "Content filter"
+			if row.Reporter.Valid {
+				reporter = row.Reporter.String
+			}
+			reports[i].Reports = append(reports[i].Reports, viewAdmin.ReportReason{
+				Reporter:  reporter,
+				Reason:    row.Reason,
+				CreatedAt: row.CreatedAt.Time,
+			})
+		}
+
+		if err := viewAdmin.ReportsPage(reports).Render(ctx, w); err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+	}
+}
+
+// reportItem returns the reported message of the row along with the
+// messages around it. Replies are shown within their thread.
+func reportItem(ctx context.Context, db *database.Queries, row database.ListOpenReportsRow) (viewAdmin.ReportItem, error) {
+	item := viewAdmin.ReportItem{
+		MessageID: row.MessageID,
+		Author:    row.Author,
+		Channel:   "Direct message",
+	}
+	if row.RoomName.Valid {
+		item.Channel = "#" + row.RoomName.String
+	}
+
+	hist := history{db: db, roomID: row.RoomID.Int64, conversationID: row.ConversationID.Int64}
+	var (
+		messages []model.ChatMessage
+		err      error
+	)
+	if row.ParentID.Valid {
+		messages, err = hist.thread(ctx, row.ParentID.Int64)
+	} else {
+		messages, err = hist.around(ctx, row.MessageID, reportContext)
+	}
+	if err != nil {
+		return item, err
+	}
+
+	// Threads can be long; only keep the replies around the reported one.
+	reported := 0
+	for i, msg := range messages {
+		if msg.ID == row.MessageID {
+			reported = i
+		}
+	}
+	messages = messages[max(0, reported-reportContext):min(len(messages), reported+reportContext+1)]
+
+	for _, msg := range messages {
+		item.Context = append(item.Context, viewAdmin.ContextMessage{
+			Username: msg.Username,
+			Content:  msg.Content,
+			Deleted:  msg.Deleted,
+			Reported: msg.ID == row.MessageID,
+		})
+	}
+
+	return item, nil
+}
+
+// SubmitReportAction closes the open reports of the {id} message with the
+// {action}: resolve, dismiss, delete the message or ban its author.
+func SubmitReportAction(hub *ws.Hub, db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		actorID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+		actorRole, err := auth.GetRoleFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data.", http.StatusBadRequest)
+			log.Printf("failed to parse form values: %v", err)
+			return
+		}
+
+		messageID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid message.", http.StatusBadRequest)
+			return
+		}
+		message, err := db.GetMessage(ctx, messageID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "Message not found.", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to retrieve message from db: %v", err)
+			return
+		}
+
+		action := chi.URLParam(r, "action")
+		status, outcome := reportResolved, "Resolved"
+		switch action {
+		case "resolve":
+		case "dismiss":
+			status, outcome = reportDismissed, "Dismissed"
+
+		case "delete":
+			outcome = "Message deleted"
+			if message.DeletedAt.Valid {
+				break
+			}
+
+			// The hub deletes the message as if the moderator did so from the
+			// chat, so that connected users see it go. The reports stay open
+			// unless it did.
+			err := hub.DeleteMessage(ctx, actorID, ws.Channel{
+				RoomID:         message.RoomID.Int64,
+				ConversationID: message.ConversationID.Int64,
+			}, messageID)
+			switch {
+			case errors.Is(err, ws.ErrUndelivered):
+				// Connected users see it go once they reload.
+				log.Printf("message %d deleted but not delivered: %v", messageID, err)
+			case err != nil:
+				http.Error(w, "The message could not be deleted.", http.StatusInternalServerError)
+				log.Printf("failed to delete message %d: %v", messageID, err)
+				return
+			}
+
+		case sanctionBan:
+			author, err := db.GetUserById(ctx, message.UserID)
+			if err != nil {
+				http.Error(w, "Database error.", http.StatusInternalServerError)
+				log.Printf("failed to retrieve user from db: %v", err)
+				return
+			}
+			if auth.Role(author.Role).AtLeast(actorRole) {
+				http.Error(w, "You cannot moderate this user.", http.StatusForbidden)
+				return
+			}
+			expiresAt, err := sanctionExpiry(sanctionBan, r.PostFormValue("duration"))
+			if err != nil {
+				http.Error(w, "Invalid duration.", http.StatusBadRequest)
+				return
+			}
+			if _, err := sanctionUser(r, hub, db, actorID, author, sanctionBan, "Reported message", expiresAt); err != nil {
+				http.Error(w, "Database error.", http.StatusInternalServerError)
+				log.Printf("failed to ban user: %v", err)
+				return
+			}
+			outcome = "Author banned"
+
+		default:
+			http.Error(w, "Invalid action.", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := db.CloseReports(ctx, database.CloseReportsParams{
+			MessageID:  messageID,
+			Status:     status,
+			ResolvedBy: pgtype.UUID{Bytes: actorID, Valid: true},
+		}); err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to close reports: %v", err)
+			return
+		}
+
+		event := audit.NewEvent(r, audit.EventReportClosed)
+		event.TargetID = message.UserID.Bytes
+		event.Metadata = map[string]any{"message_id": messageID, "action": action}
+		audit.Record(ctx, db, event)
+
+		if err := viewAdmin.ReportClosed(outcome).Render(ctx, w); err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+
+		slog.InfoContext(ctx, "reports closed",
+			slog.Int64("message_id", messageID),
+			slog.String("action", action),
+			slog.String("by", actorID.String()))
+	}
+}
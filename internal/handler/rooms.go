@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	viewAuth "github.com/johndosdos/chatter/components/auth"
+	viewChat "github.com/johndosdos/chatter/components/chat"
+	"github.com/johndosdos/chatter/internal/auth"
+	"github.com/johndosdos/chatter/internal/database"
+	ws "github.com/johndosdos/chatter/internal/websocket"
+)
+
+// DefaultRoom is the room every user lands in after logging in. It is
+// created by the rooms migration.
+const DefaultRoom = "general"
+
+type roomContextKey string
+
+const roomKey roomContextKey = "room"
+
+// Room names are used as URL path segments, so we keep them short and
+// URL-safe.
+var roomNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,31}$`)
+
+// RoomMiddleware resolves the {room} URL parameter and checks that the
+// current user is a member of it. The room is appended to the request
+// context for the next handler.
+func RoomMiddleware(db *database.Queries) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			userID, err := auth.GetUserFromContext(ctx)
+			if err != nil {
+				log.Printf("%v", err)
+				redirect(w, r, "/account/login")
+				return
+			}
+
+			room, err := db.GetRoomByName(ctx, chi.URLParam(r, "room"))
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					http.Error(w, "Room not found.", http.StatusNotFound)
+					return
+				}
+				http.Error(w, "Database error.", http.StatusInternalServerError)
+				log.Printf("failed to retrieve room from db: %v", err)
+				return
+			}
+
+			isMember, err := db.IsRoomMember(ctx, database.IsRoomMemberParams{
+				RoomID: room.ID,
+				UserID: pgtype.UUID{Bytes: userID, Valid: true},
+			})
+			if err != nil {
+				http.Error(w, "Database error.", http.StatusInternalServerError)
+				log.Printf("failed to check room membership: %v", err)
+				return
+			}
+			if !isMember {
+				redirect(w, r, "/rooms")
+				return
+			}
+
+			r = r.WithContext(context.WithValue(ctx, roomKey, room))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetRoomFromContext returns the room resolved by RoomMiddleware, otherwise
+// it returns an error.
+func GetRoomFromContext(ctx context.Context) (database.Room, error) {
+	room, ok := ctx.Value(roomKey).(database.Room)
+	if !ok {
+		return database.Room{}, errors.New("failed to assert roomKey to database.Room")
+	}
+
+	return room, nil
+}
+
+// ServeDefaultRoom redirects the client to the default room.
+func ServeDefaultRoom() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/chat/"+DefaultRoom, http.StatusSeeOther)
+	}
+}
+
+// ServeRooms lists every room along with the current user's membership,
+// and the user's direct conversations.
+func ServeRooms(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		rows, err := db.ListRooms(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to list rooms: %v", err)
+			return
+		}
+
+		rooms := make([]viewChat.RoomItem, 0, len(rows))
+		for _, row := range rows {
+			rooms = append(rooms, viewChat.RoomItem{
+				Name:     row.Name,
+				IsMember: row.IsMember,
+			})
+		}
+
+		conversations, err := db.ListConversations(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to list conversations: %v", err)
+			return
+		}
+
+		peers := make([]string, 0, len(conversations))
+		for _, conversation := range conversations {
+			peers = append(peers, conversation.Username)
+		}
+
+		if err := viewChat.RoomsPage(rooms, peers).Render(ctx, w); err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+	}
+}
+
+// SubmitCreateRoom creates a new room and makes its creator the first
+// member.
+func SubmitCreateRoom(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data.", http.StatusBadRequest)
+			log.Printf("failed to parse form values: %v", err)
+			return
+		}
+
+		name := r.PostFormValue("name")
+		if !roomNameRe.MatchString(name) {
+			if err := viewAuth.ErrorMsgAuth("Room names are 2-32 lowercase letters, digits or dashes.").Render(ctx, w); err != nil {
+				log.Printf("failed to render component: %v", err)
+			}
+			return
+		}
+
+		room, err := db.CreateRoom(ctx, database.CreateRoomParams{
+			Name:      name,
+			CreatedBy: pgtype.UUID{Bytes: userID, Valid: true},
+		})
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				if err := viewAuth.ErrorMsgAuth("Room already exists.").Render(ctx, w); err != nil {
+					log.Printf("failed to render component: %v", err)
+				}
+				return
+			}
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to create room entry in database: %v", err)
+			return
+		}
+
+		err = db.JoinRoom(ctx, database.JoinRoomParams{
+			RoomID: room.ID,
+			UserID: pgtype.UUID{Bytes: userID, Valid: true},
+		})
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to join room: %v", err)
+			return
+		}
+
+		w.Header().Set("HX-Redirect", "/chat/"+room.Name)
+		w.WriteHeader(http.StatusOK)
+
+		slog.InfoContext(ctx, "room created",
+			slog.String("room", room.Name))
+	}
+}
+
+// SubmitJoinRoom adds the current user to the room's members.
+func SubmitJoinRoom(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		room, err := db.GetRoomByName(ctx, chi.URLParam(r, "room"))
+		if err != nil {
+			http.Error(w, "Room not found.", http.StatusNotFound)
+			log.Printf("failed to retrieve room from db: %v", err)
+			return
+		}
+
+		err = db.JoinRoom(ctx, database.JoinRoomParams{
+			RoomID: room.ID,
+			UserID: pgtype.UUID{Bytes: userID, Valid: true},
+		})
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to join room: %v", err)
+			return
+		}
+
+		w.Header().Set("HX-Redirect", "/chat/"+room.Name)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// SubmitLeaveRoom removes the current user from the room's members, and
+// disconnects them from the room.
+func SubmitLeaveRoom(hub *ws.Hub, db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		room, err := db.GetRoomByName(ctx, chi.URLParam(r, "room"))
+		if err != nil {
+			http.Error(w, "Room not found.", http.StatusNotFound)
+			log.Printf("failed to retrieve room from db: %v", err)
+			return
+		}
+
+		err = db.LeaveRoom(ctx, database.LeaveRoomParams{
+			RoomID: room.ID,
+			UserID: pgtype.UUID{Bytes: userID, Valid: true},
+		})
+		if err != nil {
+			http.Error(w, "Database error.", http.StatusInternalServerError)
+			log.Printf("failed to leave room: %v", err)
+			return
+		}
+
+		// The membership is gone, so the user cannot reconnect. A busy hub
+		// only leaves the open connections in the room for a while.
+		if err := hub.Leave(ctx, userID, ws.Channel{RoomID: room.ID}); err != nil {
+			log.Printf("failed to disconnect user from room: %v", err)
+		}
+
+		w.Header().Set("HX-Redirect", "/rooms")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// redirect sends the client to url. HTMX requests only follow redirects
+// through the HX-Redirect header.
+func redirect(w http.ResponseWriter, r *http.Request, url string) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", url)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	viewChat "github.com/johndosdos/chatter/components/chat"
+	"github.com/johndosdos/chatter/internal/auth"
+	"github.com/johndosdos/chatter/internal/database"
+)
+
+// searchLimit is the number of results returned per search.
+const searchLimit = 50
+
+// ServeSearch searches the messages of the rooms the current user is a
+// member of and of their direct conversations, best matches first.
+//
+// The search form is submitted by HTMX, in which case only the results are
+// rendered. Loading the URL directly renders the whole page.
+func ServeSearch(db *database.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.GetUserFromContext(ctx)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+
+		query := r.URL.Query()
+		filters := viewChat.SearchFilters{
+			Query:      strings.TrimSpace(query.Get("q")),
+			Author:     strings.TrimPrefix(strings.TrimSpace(query.Get("from")), "@"),
+			Since:      query.Get("since"),
+			Until:      query.Get("until"),
+			HasMention: query.Get("mentions") == "true",
+		}
+
+		var results []viewChat.SearchResult
+		if filters.Query != "" {
+			since, err := parseDate(filters.Since)
+			if err != nil {
+				http.Error(w, "Invalid date.", http.StatusBadRequest)
+				return
+			}
+
+			until, err := parseDate(filters.Until)
+			if err != nil {
+				http.Error(w, "Invalid date.", http.StatusBadRequest)
+				return
+			}
+			// Include the whole day.
+			until.Time = until.Time.AddDate(0, 0, 1)
+
+			rows, err := db.SearchMessages(ctx, database.SearchMessagesParams{
+				UserID:      pgtype.UUID{Bytes: userID, Valid: true},
+				Query:       filters.Query,
+				Author:      filters.Author,
+				Since:       since,
+				Until:       until,
+				HasMention:  filters.HasMention,
+				ResultLimit: searchLimit,
+			})
+			if err != nil {
+				http.Error(w, "Database error.", http.StatusInternalServerError)
+				log.Printf("failed to search messages: %v", err)
+				return
+			}
+
+			results, err = searchResults(ctx, db, rows)
+			if err != nil {
+				http.Error(w, "Database error.", http.StatusInternalServerError)
+				log.Printf("failed to list mentions: %v", err)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+
+		searched := filters.Query != ""
+		if r.Header.Get("HX-Request") == "true" {
+			err = viewChat.SearchResults(results, searched).Render(ctx, w)
+		} else {
+			err = viewChat.SearchPage(filters, results, searched).Render(ctx, w)
+		}
+		if err != nil {
+			log.Printf("failed to render component: %v", err)
+		}
+	}
+}
+
+// searchResults converts the rows, linking every message to its
+// permalink.
+func searchResults(ctx context.Context, db *database.Queries, rows []database.SearchMessagesRow) ([]viewChat.SearchResult, error) {
+	ids := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+
+	mentionRows, err := db.ListMentions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	mentions := make(map[int64][]string)
+	for _, row := range mentionRows {
+		mentions[row.MessageID] = append(mentions[row.MessageID], row.Username)
+	}
+
+	results := make([]viewChat.SearchResult, 0, len(rows))
+	for _, row := range rows {
+		channel := "# " + row.RoomName.String
+		if !row.RoomName.Valid {
+			channel = "@ " + row.PeerUsername.String
+		}
+
+		results = append(results, viewChat.SearchResult{
+			ID:        row.ID,
+			Username:  row.Username,
+			Content:   row.Content,
+			Mentions:  mentions[row.ID],
+			Channel:   channel,
+			URL:       viewChat.Permalink(row.ID),
+			CreatedAt: row.CreatedAt.Time.UTC().Format("Jan 2, 2006 15:04"),
+		})
+	}
+
+	return results, nil
+}
+
+// parseDate parses a date input value. An empty value is a NULL timestamp.
+func parseDate(value string) (pgtype.Timestamptz, error) {
+	if value == "" {
+		return pgtype.Timestamptz{}, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return pgtype.Timestamptz{}, err
+	}
+
+	return pgtype.Timestamptz{Time: t, Valid: true}, nil
+}
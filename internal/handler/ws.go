@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"cmp"
+	"encoding/json"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/coder/websocket"
 	"github.com/jackc/pgx/v5/pgtype"
 
 	"github.com/johndosdos/chatter/internal/auth"
@@ -14,7 +17,7 @@ import (
 )
 
 // ServeWs handles the client's websocket connection upgrade.
-func ServeWs(h *ws.Hub, db *database.Queries) http.HandlerFunc {
+func ServeWs(h *ws.Hub, upgrader *ws.Upgrader, db *database.Queries) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -32,6 +35,18 @@ func ServeWs(h *ws.Hub, db *database.Queries) http.HandlerFunc {
 			return
 		}
 
+		// A client either connects to a room or to a direct conversation.
+		var channel ws.Channel
+		if room, err := GetRoomFromContext(ctx); err == nil {
+			channel.RoomID = room.ID
+		} else if conversation, err := GetConversationFromContext(ctx); err == nil {
+			channel.ConversationID = conversation.ID
+		} else {
+			slog.WarnContext(ctx, "unable to get channel from request context",
+				"error", err)
+			return
+		}
+
 		user, err := db.GetUserById(ctx, pgtype.UUID{Bytes: userID, Valid: true})
 		if err != nil {
 			slog.ErrorContext(ctx, "failed to get user from DB",
@@ -39,28 +54,68 @@ func ServeWs(h *ws.Hub, db *database.Queries) http.HandlerFunc {
 			return
 		}
 
-		conn, err := websocket.Accept(w, r, nil)
+		// Banned users keep a valid access token until it expires, so they are
+		// turned away here as well.
+		if _, banned, err := activeSanction(ctx, db, userID, sanctionBan); err != nil || banned {
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to get ban from DB",
+					"error", err)
+			}
+			http.Error(w, "Forbidden.", http.StatusForbidden)
+			return
+		}
+		mute, muted, err := activeSanction(ctx, db, userID, sanctionMute)
 		if err != nil {
-			slog.WarnContext(ctx, "WS handshake failed",
+			slog.ErrorContext(ctx, "failed to get mute from DB",
 				"error", err)
+		}
+
+		conn, release, err := upgrader.Upgrade(w, r, userID)
+		if err != nil {
+			slog.WarnContext(ctx, "WS handshake failed",
+				"error", err,
+				"username", user.Username)
 			return
 		}
+		defer release()
 
 		slog.InfoContext(ctx, "user connection upgrade",
-			slog.String("username", user.Username))
+			slog.String("username", user.Username),
+			slog.Int64("room_id", channel.RoomID),
+			slog.Int64("conversation_id", channel.ConversationID))
 
 		// We'll register our new client to the central hub.
-		c := ws.NewClient(conn, user.UserID.Bytes, user.Username)
+		path := strings.TrimSuffix(r.URL.Path, "/ws")
+		c := ws.NewClient(conn, user.UserID.Bytes, user.Username, channel, path)
+		c.Role = auth.Role(user.Role)
+		if muted {
+			c.SetMute(mute.ExpiresAt.Time)
+		}
 		reg := ws.Registration{
 			Client: c,
 			Done:   make(chan struct{}),
 		}
 
+		// Start the client off with the user's unread count.
+		hist := history{db: db, roomID: channel.RoomID, conversationID: channel.ConversationID}
+		lastRead, err := hist.lastRead(ctx, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to get read marker from DB",
+				"error", err)
+		}
+		unread, err := hist.unread(ctx, userID, lastRead)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to count unread messages",
+				"error", err)
+		}
+		c.SetReadMarker(lastRead, unread)
+
 		messageReq := 30
 		typingReq := 30
 
 		c.SetMessageLimiter(messageReq, time.Minute)
 		c.SetTypingLimiter(typingReq, time.Minute)
+		c.SetReadLimits(upgrader.ReadLimits())
 
 		h.Register <- reg
 
@@ -73,6 +128,30 @@ func ServeWs(h *ws.Hub, db *database.Queries) http.HandlerFunc {
 		// We block on c.ReadMessage() because the request context will be canceled as soon
 		// we return from the ServeWs() handler.
 		go c.WriteMessage(ctx)
+		go c.Heartbeat(ctx)
 		c.ReadMessage(ctx)
 	}
 }
+
+// ServeQueueMetrics lists the queues of the clients connected to this
+// instance as JSON, the most backed up first.
+func ServeQueueMetrics(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := hub.Metrics(r.Context())
+		if err != nil {
+			http.Error(w, "Hub unavailable.", http.StatusServiceUnavailable)
+			slog.ErrorContext(r.Context(), "failed to get queue metrics",
+				"error", err)
+			return
+		}
+		slices.SortFunc(metrics, func(a, b ws.ClientMetrics) int {
+			return cmp.Or(b.Queued-a.Queued, b.MaxQueued-a.MaxQueued)
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(metrics); err != nil {
+			slog.ErrorContext(r.Context(), "failed to encode queue metrics",
+				"error", err)
+		}
+	}
+}
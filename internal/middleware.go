@@ -8,11 +8,14 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/johndosdos/chatter/internal/audit"
 	"github.com/johndosdos/chatter/internal/auth"
 	"github.com/johndosdos/chatter/internal/database"
 )
 
-// Middleware validates the client's JWT.
+// Middleware validates the client's JWT. The user's ID and role are
+// appended to the request context for the next handler.
 func Middleware(db *database.Queries) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -20,10 +23,9 @@ func Middleware(db *database.Queries) func(http.Handler) http.Handler {
 			// Check JWT cookie if it exists. If it does, validate the JWT. If valid,
 			// append user ID to context and serve the next handler.
 			if err == nil {
-				uuid, err := auth.ValidateJWT(jwtCookie.Value, os.Getenv("JWT_SECRET"))
+				uuid, role, err := auth.ValidateJWT(jwtCookie.Value, os.Getenv("JWT_SECRET"))
 				if err == nil {
-					r = r.WithContext(context.WithValue(r.Context(), auth.UserIDKey, uuid))
-					next.ServeHTTP(w, r)
+					next.ServeHTTP(w, withUser(r, uuid, role))
 					return
 				}
 			}
@@ -60,7 +62,7 @@ func Middleware(db *database.Queries) func(http.Handler) http.Handler {
 			}
 
 			jwtExp := 5 * time.Minute
-			err = auth.SetTokensAndCookies(w, r, db,
+			role, err := auth.SetTokensAndCookies(w, r, db,
 				refreshTokenDB.UserID.Bytes,
 				time.Until(refreshTokenDB.ExpiresAt.Time),
 				jwtExp)
@@ -69,8 +71,49 @@ func Middleware(db *database.Queries) func(http.Handler) http.Handler {
 				return
 			}
 
-			r = r.WithContext(context.WithValue(r.Context(), auth.UserIDKey, uuid.UUID(refreshTokenDB.UserID.Bytes)))
+			r = withUser(r, uuid.UUID(refreshTokenDB.UserID.Bytes), role)
+			audit.Record(r.Context(), db, audit.NewEvent(r, audit.EventTokenRefresh))
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// withUser appends the user's ID and role to the request context. The role
+// comes from the access token, so it may be a few minutes old: RequireRole
+// and the hub check the current role before anything privileged.
+func withUser(r *http.Request, userID uuid.UUID, role auth.Role) *http.Request {
+	ctx := context.WithValue(r.Context(), auth.UserIDKey, userID)
+	ctx = context.WithValue(ctx, auth.RoleKey, role)
+
+	return r.WithContext(ctx)
+}
+
+// RequireRole only serves the next handler to users holding the given role
+// or a role above it. The role is read from the database, so that role
+// changes apply immediately, and replaces the one appended by Middleware.
+func RequireRole(db *database.Queries, role auth.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := auth.GetUserFromContext(r.Context())
+			if err != nil {
+				log.Printf("%v", err)
+				http.Error(w, "Forbidden.", http.StatusForbidden)
+				return
+			}
+
+			userRole, err := db.GetUserRole(r.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+			if err != nil {
+				log.Printf("failed to get user role: %v", err)
+				http.Error(w, "Forbidden.", http.StatusForbidden)
+				return
+			}
+
+			if !auth.Role(userRole).AtLeast(role) {
+				http.Error(w, "Forbidden.", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, withUser(r, userID, auth.Role(userRole)))
+		})
+	}
+}
@@ -31,7 +31,7 @@ func helper(t *testing.T,
 		return req, rec
 	}
 
-	jwtStr, err := auth.MakeJWT(user.UserID.Bytes, os.Getenv("JWT_SECRET"), jwtExp)
+	jwtStr, err := auth.MakeJWT(user.UserID.Bytes, auth.Role(user.Role), os.Getenv("JWT_SECRET"), jwtExp)
 	if err != nil {
 		t.Fatalf("%+v", err)
 	}
@@ -112,3 +112,78 @@ func TestMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireRole(t *testing.T) {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("failed to load .env file: %+v", err)
+	}
+
+	db, dbForGoose, migDir := testutil.DbInit()
+	testutil.DbGooseUp(dbForGoose, migDir)
+	defer testutil.DbCleanup(db, migDir)
+
+	queries := database.New(db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	users := make(map[auth.Role]uuid.UUID)
+	for _, role := range auth.Roles {
+		userID := uuid.New()
+		if _, err := queries.CreateUser(ctx, database.CreateUserParams{
+			UserID:   pgtype.UUID{Bytes: userID, Valid: true},
+			Username: string(role),
+			Email:    string(role) + "@test.com",
+		}); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if _, err := queries.SetUserRole(ctx, database.SetUserRoleParams{
+			Username: string(role),
+			Role:     string(role),
+		}); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		users[role] = userID
+	}
+
+	tests := []struct {
+		Name   string
+		userID uuid.UUID
+		// tokenRole is the role in the access token, which may be stale.
+		tokenRole         auth.Role
+		wantHandlerCalled bool
+		wantCode          int
+	}{
+		{"admin", users[auth.RoleAdmin], auth.RoleAdmin, true, http.StatusOK},
+		{"moderator", users[auth.RoleModerator], auth.RoleModerator, true, http.StatusOK},
+		{"member", users[auth.RoleMember], auth.RoleMember, false, http.StatusForbidden},
+		{"demoted", users[auth.RoleMember], auth.RoleAdmin, false, http.StatusForbidden},
+		{"promoted", users[auth.RoleModerator], auth.RoleMember, true, http.StatusOK},
+		{"unknown_user", uuid.New(), auth.RoleAdmin, false, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req = withUser(req.WithContext(ctx), tt.userID, tt.tokenRole)
+			rec := httptest.NewRecorder()
+
+			isHandlerCalled := false
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				isHandlerCalled = true
+				w.WriteHeader(http.StatusOK)
+			})
+
+			handler := RequireRole(queries, auth.RoleModerator)(nextHandler)
+			handler.ServeHTTP(rec, req)
+
+			if isHandlerCalled != tt.wantHandlerCalled {
+				t.Errorf("handler called = %v, want %v", isHandlerCalled, tt.wantHandlerCalled)
+			}
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("want %d, got %d", tt.wantCode, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// MentionPattern matches @username tokens. The first submatch is the
+// username.
+var MentionPattern = regexp.MustCompile(`(?:^|\s)@([\w.-]*\w)`)
+
+// Mention is a user mentioned in a message.
+type Mention struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+}
+
+// ParseMentions returns the usernames mentioned in content, without
+// duplicates, in the order they first appear.
+func ParseMentions(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range MentionPattern.FindAllStringSubmatch(content, -1) {
+		if username := match[1]; !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+
+	return usernames
+}
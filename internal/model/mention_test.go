@@ -0,0 +1,31 @@
+package model
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"none", "hello there", nil},
+		{"single", "@alice hi", []string{"alice"}},
+		{"several", "hi @alice and @bob.", []string{"alice", "bob"}},
+		{"duplicates", "@alice @bob @alice", []string{"alice", "bob"}},
+		{"punctuation", "ping @john.doe-2!", []string{"john.doe-2"}},
+		{"email", "mail me at alice@example.com", nil},
+		{"bare at", "@ nobody", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ParseMentions(tc.content)
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("ParseMentions(%q) = %q, want %q", tc.content, got, tc.want)
+			}
+		})
+	}
+}
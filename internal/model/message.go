@@ -7,16 +7,74 @@ import (
 )
 
 // ChatMessage represents a message for the chat application,
-// used for both NATS payloads and WebSocket communication.
+// used for both broker payloads and WebSocket communication.
 type ChatMessage struct {
-	ID        int64     `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	Username  string    `json:"username"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	ID             int64      `json:"id"`
+	RoomID         int64      `json:"room_id"`
+	ConversationID int64      `json:"conversation_id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	Username       string     `json:"username"`
+	Content        string     `json:"content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Edited         bool       `json:"edited,omitempty"`
+	Deleted        bool       `json:"deleted,omitempty"`
+	Reactions      []Reaction `json:"reactions,omitempty"`
+	Mentions       []Mention  `json:"mentions,omitempty"`
+	Receipt        Receipt    `json:"receipt,omitzero"`
+
+	// IDs holds the messages rendered by the browser, sent to acknowledge
+	// their delivery. Receipts carries the updated receipts of several
+	// messages at once.
+	IDs      []int64   `json:"ids,omitempty"`
+	Receipts []Receipt `json:"receipts,omitempty"`
+
+	// Pins holds every message pinned to the channel, latest first.
+	Pins []Pin `json:"pins,omitempty"`
+
+	// Until is when the mute of the user ends. The zero time lifts it.
+	Until time.Time `json:"until,omitzero"`
+
+	// ParentID is the message starting the thread a reply belongs to.
+	ParentID int64  `json:"parent_id,omitempty"`
+	Thread   Thread `json:"thread,omitzero"`
 
 	// The HTTP request headers sent during websocket transmission
 	// used for typing indicator information.
 	Headers map[string]string `json:"HEADERS"`
 	Type    string            `json:"type,omitempty"`
+
+	// Origin is the ID of the chatter instance that published the payload
+	// to the broker.
+	Origin string `json:"origin,omitempty"`
+}
+
+// Reaction holds the users who reacted to a message with the same emoji,
+// in the order they reacted.
+type Reaction struct {
+	Emoji   string      `json:"emoji"`
+	UserIDs []uuid.UUID `json:"user_ids"`
+}
+
+// Thread summarizes the replies to a message.
+type Thread struct {
+	Replies int `json:"replies"`
+	// Username and Content are taken from the latest reply.
+	Username string `json:"username"`
+	Content  string `json:"content"`
+}
+
+// Receipt counts the recipients who received and read a message.
+type Receipt struct {
+	MessageID int64 `json:"message_id"`
+	// SenderID is the author of the message.
+	SenderID  uuid.UUID `json:"sender_id"`
+	Delivered int       `json:"delivered"`
+	Seen      int       `json:"seen"`
+}
+
+// Pin previews a message pinned to its channel.
+type Pin struct {
+	MessageID int64  `json:"message_id"`
+	Username  string `json:"username"`
+	Content   string `json:"content"`
 }
@@ -23,11 +23,17 @@ type ipAddr string
 type IPRateLimiter struct {
 	limiters map[ipAddr]*rate.Limiter
 	lastSeen map[ipAddr]time.Time
+	// reported holds when OnLimit was last called for an IP address.
+	reported map[ipAddr]time.Time
 	mu       sync.Mutex
 	Cancel   context.CancelFunc
 	rate     rate.Limit
 	burst    int
+	window   time.Duration
 	CleanupOpts
+	// OnLimit, if set, is called when an IP address is first turned away,
+	// then at most once per window while it keeps being turned away.
+	OnLimit func(r *http.Request)
 }
 
 func NewIPRateLimiter(requests int, window time.Duration, cleanupOpts CleanupOpts) *IPRateLimiter {
@@ -35,10 +41,12 @@ func NewIPRateLimiter(requests int, window time.Duration, cleanupOpts CleanupOpt
 	rl := &IPRateLimiter{
 		limiters:    make(map[ipAddr]*rate.Limiter),
 		lastSeen:    make(map[ipAddr]time.Time),
+		reported:    make(map[ipAddr]time.Time),
 		Cancel:      cancel,
 		mu:          sync.Mutex{},
 		rate:        rate.Every(window / time.Duration(requests)),
 		burst:       requests,
+		window:      window,
 		CleanupOpts: cleanupOpts,
 	}
 
@@ -62,6 +70,7 @@ func (rl *IPRateLimiter) cleanup(ctx context.Context) {
 				if time.Since(ls) > rl.TTL {
 					delete(rl.limiters, ip)
 					delete(rl.lastSeen, ip)
+					delete(rl.reported, ip)
 				}
 			}
 
@@ -71,10 +80,15 @@ func (rl *IPRateLimiter) cleanup(ctx context.Context) {
 }
 
 func (rl *IPRateLimiter) GetClientIP(r *http.Request) ipAddr {
+	return ipAddr(ClientIP(r))
+}
+
+// ClientIP returns the IP address of the client behind the request.
+func ClientIP(r *http.Request) string {
 	xff := http.Header.Get(r.Header, "X-Forwarded-For")
 	if xff != "" {
 		ips := strings.Split(xff, ",")
-		return ipAddr(strings.TrimSpace(ips[len(ips)-1]))
+		return strings.TrimSpace(ips[len(ips)-1])
 	}
 
 	host, _, err := net.SplitHostPort(r.RemoteAddr)
@@ -82,10 +96,10 @@ func (rl *IPRateLimiter) GetClientIP(r *http.Request) ipAddr {
 		//nolint:gosec
 		slog.Warn("invalid argument for net.SplitHostPort()",
 			slog.String("remote_addr", r.RemoteAddr))
-		return ipAddr(r.RemoteAddr)
+		return r.RemoteAddr
 	}
 
-	return ipAddr(host)
+	return host
 }
 
 func (rl *IPRateLimiter) Allow(ip ipAddr) bool {
@@ -102,6 +116,20 @@ func (rl *IPRateLimiter) Allow(ip ipAddr) bool {
 	return bucket.Allow()
 }
 
+// report tells whether OnLimit should be called for an IP address turned
+// away, and records that it was.
+func (rl *IPRateLimiter) report(ip ipAddr) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := rl.reported[ip]; ok && now.Sub(last) < rl.window {
+		return false
+	}
+	rl.reported[ip] = now
+	return true
+}
+
 func (rl *IPRateLimiter) Middleware(next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ip := rl.GetClientIP(r)
@@ -111,6 +139,9 @@ func (rl *IPRateLimiter) Middleware(next http.Handler) http.HandlerFunc {
 				"ip", ip,
 				"path", r.URL.Path,
 				"method", r.Method)
+			if rl.OnLimit != nil && rl.report(ip) {
+				rl.OnLimit(r)
+			}
 
 			if r.Header.Get("HX-Request") == "true" {
 				err := viewAuth.ErrorMsgAuth("Too many requests. Try again later.").Render(r.Context(), w)
@@ -0,0 +1,48 @@
+package websocket
+
+import (
+	"context"
+	"log"
+)
+
+// changeQueueSize bounds the edits, deletions, reactions, pins, read markers
+// and moderation requests waiting to be applied. Senders are told to try
+// again once it is full.
+const changeQueueSize = 256
+
+// runChanges applies every payload other than new messages and typing
+// indicators off the hub's main loop, since they read or write the
+// database. They are applied one at a time, in the order they were queued.
+//
+// Like runPersist, it returns once Run closes the queue, after applying the
+// payloads still queued.
+func (h *Hub) runChanges(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+
+	for req := range h.changes {
+		// Failures are logged, and the sender told when it matters.
+		err := h.handle(ctx, req.payload)
+		if req.done != nil {
+			req.done <- err
+		}
+	}
+}
+
+// queueChange hands a payload over to runChanges. When the queue is full,
+// requests fail with ErrBusy and users are told to try again. Read markers
+// are dropped instead; the next one moves the marker further.
+func (h *Hub) queueChange(ctx context.Context, req hubRequest) {
+	select {
+	case h.changes <- req:
+		return
+	default:
+	}
+
+	log.Printf("change queue full, rejecting %s of user %s", req.payload.Type, req.payload.UserID)
+	switch {
+	case req.done != nil:
+		req.done <- ErrBusy
+	case req.payload.Type != payloadRead:
+		h.rejectLocal(ctx, req.payload, noticeBusy)
+	}
+}
@@ -5,33 +5,168 @@ import (
 	"log"
 	"log/slog"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/a-h/templ"
 	"github.com/coder/websocket"
 	"github.com/google/uuid"
 	"github.com/johndosdos/chatter/components/chat"
+	"github.com/johndosdos/chatter/internal/auth"
 	"github.com/johndosdos/chatter/internal/model"
 	"golang.org/x/time/rate"
 )
 
+const (
+	// messageQueueSize is how many payloads a client can fall behind by before
+	// it is disconnected.
+	messageQueueSize = 64
+
+	// ephemeralQueueSize is how many typing indicators, presence counts and
+	// notices a client keeps queued. Older ones are dropped first.
+	ephemeralQueueSize = 8
+)
+
+// Channel identifies where a client is connected to: either a room or a
+// direct conversation between two users. Exactly one of the IDs is set.
+type Channel struct {
+	RoomID         int64
+	ConversationID int64
+}
+
 type Client struct {
-	UserID     uuid.UUID
-	Username   string
-	conn       *websocket.Conn
-	Hub        *Hub
-	MessageCh  chan model.ChatMessage
+	UserID   uuid.UUID
+	Username string
+	// Role is the user's role when they connected. It only changes what is
+	// rendered; the hub checks the current role of the user.
+	Role auth.Role
+	Channel
+	// path is the URL path of the channel, used to link messages to their
+	// thread.
+	path string
+	conn *websocket.Conn
+	// protocol is the negotiated subprotocol, which sets how payloads are
+	// read and written.
+	protocol string
+	Hub      *Hub
+	// MessageCh queues the payloads that must all reach the client, such as
+	// messages and edits. Clients too slow to keep up are disconnected by the
+	// hub rather than skipping any.
+	MessageCh chan model.ChatMessage
+	// ephemeralCh queues the payloads only worth showing while they are
+	// fresh: typing indicators, presence counts and notices. The oldest are
+	// dropped when it is full.
+	ephemeralCh chan model.ChatMessage
+	// slow is set by the hub once the client fell behind and is being
+	// disconnected.
+	slow       bool
+	queue      queueMetrics
 	messageLim *rate.Limiter
 	typingLim  *rate.Limiter
+	readLimits ReadLimits
 	timeWarned time.Time // For rendering the rate limit message. Do not re-render if a message is already there
+	// muted holds the end of the user's mute in Unix nanoseconds, or 0. It is
+	// set by WriteMessage and checked by ReadMessage.
+	muted          atomic.Int64
+	timeMuteWarned time.Time
+	// lastActive holds when the client last sent anything, in Unix
+	// nanoseconds. It is set by ReadMessage and checked by Heartbeat.
+	lastActive atomic.Int64
+	// lastRead and unread track the user's read marker in the channel. They
+	// are owned by WriteMessage.
+	lastRead int64
+	unread   int
 }
 
-func NewClient(conn *websocket.Conn, userID uuid.UUID, username string) *Client {
+func NewClient(conn *websocket.Conn, userID uuid.UUID, username string, channel Channel, path string) *Client {
 	return &Client{
-		conn:      conn,
-		MessageCh: make(chan model.ChatMessage, 64),
-		UserID:    userID,
-		Username:  username,
+		conn:        conn,
+		protocol:    conn.Subprotocol(),
+		path:        path,
+		MessageCh:   make(chan model.ChatMessage, messageQueueSize),
+		ephemeralCh: make(chan model.ChatMessage, ephemeralQueueSize),
+		UserID:      userID,
+		Username:    username,
+		Channel:     channel,
+	}
+}
+
+// queueMetrics counts what happened to the payloads queued for a client.
+type queueMetrics struct {
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	maxDepth  atomic.Int64
+}
+
+// ClientMetrics describes the queues of a connected client.
+type ClientMetrics struct {
+	Username       string `json:"username"`
+	RoomID         int64  `json:"room_id,omitempty"`
+	ConversationID int64  `json:"conversation_id,omitempty"`
+	// Queued is the number of payloads waiting to be written.
+	Queued int `json:"queued"`
+	// MaxQueued is the most payloads that were ever waiting at once.
+	MaxQueued int `json:"max_queued"`
+	// Delivered counts the payloads queued, and Dropped the typing
+	// indicators, presence counts and notices dropped to make room.
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+}
+
+// Metrics returns the state of the client's queues.
+func (c *Client) Metrics() ClientMetrics {
+	return ClientMetrics{
+		Username:       c.Username,
+		RoomID:         c.RoomID,
+		ConversationID: c.ConversationID,
+		Queued:         len(c.MessageCh) + len(c.ephemeralCh),
+		MaxQueued:      int(c.queue.maxDepth.Load()),
+		Delivered:      c.queue.delivered.Load(),
+		Dropped:        c.queue.dropped.Load(),
+	}
+}
+
+// queued records a payload added to the client's queues.
+func (c *Client) queued() {
+	c.queue.delivered.Add(1)
+	depth := int64(len(c.MessageCh) + len(c.ephemeralCh))
+	for {
+		prev := c.queue.maxDepth.Load()
+		if depth <= prev || c.queue.maxDepth.CompareAndSwap(prev, depth) {
+			return
+		}
+	}
+}
+
+// trySend queues a payload that must reach the client without blocking. It
+// reports false when the client is too far behind.
+func (c *Client) trySend(payload model.ChatMessage) bool {
+	select {
+	case c.MessageCh <- payload:
+		c.queued()
+		return true
+	default:
+		return false
+	}
+}
+
+// sendEphemeral queues a payload that can be lost without blocking, dropping
+// the oldest queued one when the client is behind. Both the hub and
+// ReadMessage call it.
+func (c *Client) sendEphemeral(payload model.ChatMessage) {
+	for {
+		select {
+		case c.ephemeralCh <- payload:
+			c.queued()
+			return
+		default:
+		}
+
+		select {
+		case <-c.ephemeralCh:
+			c.queue.dropped.Add(1)
+		default:
+		}
 	}
 }
 
@@ -45,101 +180,306 @@ func (c *Client) SetTypingLimiter(requests int, window time.Duration) {
 	c.typingLim = l
 }
 
+// SetReadLimits caps the size of the payloads read from the client, per
+// payload type. The connection's own limit is set by the Upgrader.
+func (c *Client) SetReadLimits(limits ReadLimits) {
+	c.readLimits = limits
+}
+
+// SetMute mutes the client until the given time. The zero time lifts the
+// mute.
+func (c *Client) SetMute(until time.Time) {
+	if until.IsZero() {
+		c.muted.Store(0)
+		return
+	}
+	c.muted.Store(until.UnixNano())
+}
+
+// Muted reports whether the client is currently muted.
+func (c *Client) Muted() bool {
+	return time.Now().Before(c.mutedUntil())
+}
+
+func (c *Client) mutedUntil() time.Time {
+	until := c.muted.Load()
+	if until == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, until)
+}
+
+// SetReadMarker sets the last message the user read in the client's channel
+// and the number of messages left unread after it. It never blocks: the
+// marker is queued behind the messages, or with the notices when the client
+// is behind.
+func (c *Client) SetReadMarker(lastRead int64, unread int) {
+	payload := model.ChatMessage{
+		ID:      lastRead,
+		UserID:  c.UserID,
+		Content: strconv.Itoa(unread),
+		Type:    payloadRead,
+	}
+	if !c.trySend(payload) {
+		c.sendEphemeral(payload)
+	}
+}
+
 // WriteMessage writes and renders to the outgoing websocket stream.
 func (c *Client) WriteMessage(ctx context.Context) {
 	// In order to group messages by sender, we need to reference the
 	// previous message. We can achieve this by setting the current
 	// message as the previous after processing.
 	var prevMsg model.ChatMessage
+	// removed is set once the connection was closed by a moderator, or
+	// because the user left the channel. The hub may still send payloads
+	// until it unregisters the client, so they are drained without being
+	// written.
+	var removed bool
 	for {
+		// Typing indicators, presence counts and notices have their own queue,
+		// so that they never hold up the messages.
+		var payload model.ChatMessage
 		select {
-		case payload, ok := <-c.MessageCh:
+		case p, ok := <-c.MessageCh:
 			// We don't want to continue processing when the channel has already been
 			// closed.
 			if !ok {
+				if removed {
+					return
+				}
 				if err := c.conn.Close(websocket.StatusNormalClosure, "channel closed"); err != nil {
 					slog.Warn("websocket connection closed", slog.Any("error", err),
 						slog.String("reason", websocket.StatusNormalClosure.String()))
 				}
 				return
 			}
+			payload = p
 
-			fromSender := payload.UserID == c.UserID
-			isSameUserPrevMsg := payload.UserID == prevMsg.UserID
+		case payload = <-c.ephemeralCh:
 
-			var content templ.Component
-			switch payload.Type {
-			case payloadTyping:
-				if fromSender {
-					continue
-				}
-				content = chat.TypingIndicator(payload.Username)
+		case <-ctx.Done():
+			if err := c.conn.Close(websocket.StatusGoingAway, "context cancelled"); err != nil {
+				slog.Warn("websocket connection closed",
+					slog.Any("error", err),
+					slog.String("reason", websocket.StatusGoingAway.String()))
+			}
+			return
+		}
+		if removed {
+			continue
+		}
 
-			case payloadPresenceCount:
-				// We expect a string that contain the count of currently connected users.
-				s, err := strconv.Atoi(payload.Content)
-				if err != nil {
-					log.Printf("failed to convert string to int: %+v", err)
-					continue
-				}
-				content = chat.PresenceCount(s)
-
-			case payloadRateLimit:
-				limitWindow := 10 * time.Second // 10s penalty when burst sending 30 messages/min
-				timeRemaining := limitWindow - time.Since(c.timeWarned)
-				content = chat.RateLimitWarning(int(timeRemaining.Seconds()))
-
-			case payloadMessage:
-				if fromSender {
-					content = chat.SenderBubble(payload.Username, payload.Content, isSameUserPrevMsg, payload.ID)
-				} else {
-					content = chat.ReceiverBubble(payload.Username, payload.Content, isSameUserPrevMsg, payload.ID)
-				}
+		if c.protocol == SubprotocolJSON {
+			event, ok := c.event(payload)
+			if !ok {
+				continue
 			}
+			c.writeEvent(ctx, event)
+			if payload.Type == payloadKick || payload.Type == payloadLeave {
+				removed = true
+				c.closeRemoved(payload.Type)
+			}
+			continue
+		}
 
-			if content == nil {
+		fromSender := payload.UserID == c.UserID
+		isSameUserPrevMsg := payload.UserID == prevMsg.UserID
+
+		var content templ.Component
+		switch payload.Type {
+		case payloadTyping:
+			if fromSender {
 				continue
 			}
+			content = chat.TypingIndicator(payload.Username)
 
-			writeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			w, err := c.conn.Writer(writeCtx, websocket.MessageText)
+		case payloadPresenceCount:
+			// We expect a string that contain the count of currently connected users.
+			s, err := strconv.Atoi(payload.Content)
 			if err != nil {
-				slog.WarnContext(ctx, "failed to return a writer",
-					"error", err)
-				cancel()
+				log.Printf("failed to convert string to int: %+v", err)
 				continue
 			}
+			content = chat.PresenceCount(s)
+
+		case payloadRateLimit:
+			limitWindow := 10 * time.Second // 10s penalty when burst sending 30 messages/min
+			timeRemaining := limitWindow - time.Since(c.timeWarned)
+			content = chat.RateLimitWarning(int(timeRemaining.Seconds()))
 
-			if err := content.Render(writeCtx, w); err != nil {
-				slog.ErrorContext(ctx, "failed to render component",
-					"error", err,
-					"payload_type", payload.Type,
-					"user_id", c.UserID.String(),
-					"username", c.Username)
-				cancel()
-				if err := w.Close(); err != nil {
-					slog.Error("writer unexpectedly closed", slog.Any("error", err))
+		case payloadMessage:
+			msg := chat.Message{
+				ID:        payload.ID,
+				Username:  payload.Username,
+				Content:   payload.Content,
+				SameUser:  isSameUserPrevMsg,
+				Mentions:  chat.Mentioned(payload.Mentions),
+				Moderator: c.Role.AtLeast(auth.RoleModerator),
+			}
+			if payload.ParentID != 0 {
+				// Replies go to the thread pane, not the message area.
+				msg.SameUser = false
+				thread := chat.NewThread(c.path, payload.ParentID, payload.Thread)
+				content = chat.ThreadReply(payload.ParentID, msg, fromSender, *thread)
+				break
+			}
+
+			msg.Thread = chat.NewThread(c.path, payload.ID, model.Thread{})
+			if fromSender {
+				msg.Receipt = &chat.Receipt{}
+				content = chat.SenderBubble(msg)
+			} else {
+				content = chat.ReceiverBubble(msg)
+			}
+
+			if !fromSender && payload.ID > c.lastRead {
+				c.unread++
+				content = templ.Join(content, chat.UnreadCount(c.unread))
+			}
+
+		case payloadReceipt:
+			// Only the authors see the receipts of their messages.
+			var updates []templ.Component
+			for _, receipt := range payload.Receipts {
+				if receipt.SenderID != c.UserID {
+					continue
 				}
+				updates = append(updates, chat.ReceiptUpdate(receipt.MessageID, chat.Receipt{
+					Delivered: receipt.Delivered,
+					Seen:      receipt.Seen,
+				}))
+			}
+			if len(updates) > 0 {
+				content = templ.Join(updates...)
+			}
+
+		case payloadRead:
+			// Read markers are per user. Every connection of the user follows
+			// them.
+			if !fromSender {
+				continue
+			}
+			unread, err := strconv.Atoi(payload.Content)
+			if err != nil {
+				log.Printf("failed to convert string to int: %+v", err)
 				continue
 			}
+			c.lastRead = payload.ID
+			c.unread = unread
+			content = chat.UnreadCount(c.unread)
 
-			if err := w.Close(); err != nil {
-				slog.Error("writer unexpectedly closed", slog.Any("error", err))
+		case payloadEdit, payloadDelete:
+			// Only the author gets the controls of the updated message.
+			content = chat.MessageUpdate(chat.Message{
+				ID:        payload.ID,
+				Username:  payload.Username,
+				Content:   payload.Content,
+				Edited:    payload.Edited,
+				Deleted:   payload.Deleted,
+				Mentions:  chat.Mentioned(payload.Mentions),
+				Moderator: c.Role.AtLeast(auth.RoleModerator),
+			}, fromSender)
+			if payload.Deleted && payload.ParentID != 0 {
+				thread := chat.NewThread(c.path, payload.ParentID, payload.Thread)
+				content = templ.Join(content, chat.ThreadUpdate(payload.ParentID, *thread))
 			}
-			cancel()
 
-			// Only update prevMsg for regular messages, not typing indicators.
-			if payload.Type == payloadMessage {
-				prevMsg = payload
+		case payloadMention:
+			elsewhere := payload.RoomID != c.RoomID || payload.ConversationID != c.ConversationID
+			content = chat.MentionNotification(payload.Username, payload.Content, elsewhere)
+
+		case payloadReact:
+			content = chat.ReactionsUpdate(payload.ID, chat.Reactions(payload.Reactions, c.UserID))
+
+		case payloadPins:
+			content = chat.PinsUpdate(payload.Pins)
+
+		case payloadMute:
+			c.SetMute(payload.Until)
+			content = chat.ModerationNotice(muteNotice(payload.Until, payload.Content))
+
+		case payloadRejected:
+			// Only the author is told why their message was rejected.
+			if !fromSender {
+				continue
 			}
+			content = chat.ModerationNotice("Message not sent. " + payload.Content)
 
-		case <-ctx.Done():
-			if err := c.conn.Close(websocket.StatusGoingAway, "context cancelled"); err != nil {
-				slog.Warn("websocket connection closed",
-					slog.Any("error", err),
-					slog.String("reason", websocket.StatusGoingAway.String()))
+		case payloadMuteWarning:
+			content = chat.ModerationNotice(muteNotice(c.mutedUntil(), ""))
+
+		case payloadKick, payloadLeave:
+			removed = true
+			content = chat.ModerationNotice(payload.Content)
+		}
+
+		if content == nil {
+			continue
+		}
+
+		writeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		w, err := c.conn.Writer(writeCtx, websocket.MessageText)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to return a writer",
+				"error", err)
+			cancel()
+			continue
+		}
+
+		if err := content.Render(writeCtx, w); err != nil {
+			slog.ErrorContext(ctx, "failed to render component",
+				"error", err,
+				"payload_type", payload.Type,
+				"user_id", c.UserID.String(),
+				"username", c.Username)
+			cancel()
+			if err := w.Close(); err != nil {
+				slog.Error("writer unexpectedly closed", slog.Any("error", err))
 			}
-			return
+			continue
 		}
+
+		if err := w.Close(); err != nil {
+			slog.Error("writer unexpectedly closed", slog.Any("error", err))
+		}
+		cancel()
+
+		if removed {
+			c.closeRemoved(payload.Type)
+			continue
+		}
+
+		// Only update prevMsg for regular messages, not typing indicators or
+		// replies.
+		if payload.Type == payloadMessage && payload.ParentID == 0 {
+			prevMsg = payload
+		}
+
+	}
+}
+
+// closeRemoved closes the connection of a kicked user, or of a user who
+// left the channel. Neither close status tells the browser to reconnect.
+func (c *Client) closeRemoved(payloadType string) {
+	status, reason := websocket.StatusPolicyViolation, "kicked"
+	if payloadType == payloadLeave {
+		status, reason = websocket.StatusNormalClosure, "left the channel"
+	}
+	if err := c.conn.Close(status, reason); err != nil {
+		slog.Warn("websocket connection closed", slog.Any("error", err),
+			slog.String("reason", status.String()))
+	}
+}
+
+// muteNotice describes a mute to the muted user.
+func muteNotice(until time.Time, reason string) string {
+	if until.IsZero() || time.Now().After(until) {
+		return "You are no longer muted."
+	}
+	notice := "You are muted for another " + time.Until(until).Round(time.Second).String() + "."
+	if reason != "" {
+		notice += " Reason: " + reason
 	}
+	return notice
 }
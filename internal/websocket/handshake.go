@@ -0,0 +1,228 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+	"github.com/johndosdos/chatter/components/chat"
+	ratelimiter "github.com/johndosdos/chatter/internal/rate_limiter"
+)
+
+// SubprotocolHTML is the subprotocol of the browser client: it sends JSON
+// and receives HTML fragments to swap in. Clients that offer no subprotocol
+// get it too.
+const SubprotocolHTML = "chatter.v1.html"
+
+// SubprotocolJSON is the subprotocol of other clients: they send commands and
+// receive events as typed JSON envelopes. See protocol.go.
+const SubprotocolJSON = "chatter.v1.json"
+
+// subprotocols lists the subprotocols the server speaks, preferred first.
+var subprotocols = []string{SubprotocolHTML, SubprotocolJSON}
+
+var (
+	ErrSubprotocol        = errors.New("internal/websocket: unsupported subprotocol")
+	ErrTooManyConnections = errors.New("internal/websocket: too many connections")
+)
+
+// ReadLimits caps the size of the messages read from clients, in bytes.
+type ReadLimits struct {
+	// Max caps every message. The connection is closed before a larger
+	// message is read in full. Zero keeps the library's limit of 32 KiB.
+	Max int64
+	// Types caps the messages of some payload types below Max.
+	Types map[string]int64
+}
+
+// DefaultReadLimits leaves room for messages of a few thousand characters.
+// Payloads without content are much smaller.
+func DefaultReadLimits() ReadLimits {
+	return ReadLimits{
+		Max: 16 << 10,
+		Types: map[string]int64{
+			payloadAck:    4 << 10,
+			payloadRead:   2 << 10,
+			payloadDelete: 2 << 10,
+			payloadReact:  2 << 10,
+			payloadPin:    2 << 10,
+			payloadUnpin:  2 << 10,
+		},
+	}
+}
+
+// Handshake configures how websocket connections are accepted.
+type Handshake struct {
+	// OriginPatterns lists the origins allowed to connect besides our own
+	// host, such as "chat.example.com" or "*.example.com".
+	OriginPatterns []string
+	// Compression enables permessage-deflate for the messages of at least
+	// CompressionThreshold bytes. A zero threshold uses the library's.
+	Compression          websocket.CompressionMode
+	CompressionThreshold int
+	ReadLimits           ReadLimits
+	// MaxPerIP and MaxPerUser cap the concurrent connections from a single
+	// IP address and a single user. Zero disables the cap.
+	MaxPerIP   int
+	MaxPerUser int
+}
+
+// DefaultHandshake only accepts our own origin, without compression.
+func DefaultHandshake() Handshake {
+	return Handshake{
+		Compression: websocket.CompressionDisabled,
+		ReadLimits:  DefaultReadLimits(),
+		MaxPerIP:    50,
+		MaxPerUser:  10,
+	}
+}
+
+// ParseCompression parses a compression mode: "disabled" or empty,
+// "context_takeover" or "no_context_takeover". Context takeover compresses
+// better but keeps a sliding window in memory for every connection.
+func ParseCompression(s string) (websocket.CompressionMode, error) {
+	switch s {
+	case "", "disabled":
+		return websocket.CompressionDisabled, nil
+	case "context_takeover":
+		return websocket.CompressionContextTakeover, nil
+	case "no_context_takeover":
+		return websocket.CompressionNoContextTakeover, nil
+	}
+
+	return 0, fmt.Errorf("internal/websocket: unknown compression mode %q", s)
+}
+
+// Upgrader accepts websocket connections according to the handshake, and
+// counts them against the caps.
+type Upgrader struct {
+	handshake Handshake
+
+	mu      sync.Mutex
+	perIP   map[string]int
+	perUser map[uuid.UUID]int
+}
+
+func NewUpgrader(handshake Handshake) *Upgrader {
+	return &Upgrader{
+		handshake: handshake,
+		perIP:     make(map[string]int),
+		perUser:   make(map[uuid.UUID]int),
+	}
+}
+
+// ReadLimits returns the read limits that clients must apply.
+func (u *Upgrader) ReadLimits() ReadLimits {
+	return u.handshake.ReadLimits
+}
+
+// Upgrade accepts the websocket connection of the user. Requests from
+// other origins are refused with 403 Forbidden. Connections offering none of
+// our subprotocols, or going over the caps, are closed right after the
+// handshake with the matching close code.
+//
+// The returned function releases the connection from the caps. It must be
+// called once the connection is closed.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*websocket.Conn, func(), error) {
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		Subprotocols:         subprotocols,
+		OriginPatterns:       u.handshake.OriginPatterns,
+		CompressionMode:      u.handshake.Compression,
+		CompressionThreshold: u.handshake.CompressionThreshold,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := r.Context()
+
+	// No subprotocol is negotiated when the client offers none, which
+	// browsers do by default.
+	if conn.Subprotocol() == "" && r.Header.Get("Sec-WebSocket-Protocol") != "" {
+		refuse(ctx, conn, websocket.StatusProtocolError, "unsupported subprotocol", "")
+		return nil, nil, ErrSubprotocol
+	}
+
+	release, ok := u.acquire(ratelimiter.ClientIP(r), userID)
+	if !ok {
+		// A policy violation tells the browser not to reconnect.
+		refuse(ctx, conn, websocket.StatusPolicyViolation, "too many connections",
+			"Too many open connections. Close another tab and reload the page.")
+		return nil, nil, ErrTooManyConnections
+	}
+
+	if u.handshake.ReadLimits.Max > 0 {
+		conn.SetReadLimit(u.handshake.ReadLimits.Max)
+	}
+
+	return conn, release, nil
+}
+
+// acquire counts a connection from the IP address and user. It reports
+// false if either is over its cap.
+func (u *Upgrader) acquire(ip string, userID uuid.UUID) (func(), bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if limit := u.handshake.MaxPerIP; limit > 0 && u.perIP[ip] >= limit {
+		return nil, false
+	}
+	if limit := u.handshake.MaxPerUser; limit > 0 && u.perUser[userID] >= limit {
+		return nil, false
+	}
+	u.perIP[ip]++
+	u.perUser[userID]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			u.mu.Lock()
+			defer u.mu.Unlock()
+
+			if u.perIP[ip]--; u.perIP[ip] <= 0 {
+				delete(u.perIP, ip)
+			}
+			if u.perUser[userID]--; u.perUser[userID] <= 0 {
+				delete(u.perUser, userID)
+			}
+		})
+	}, true
+}
+
+// refuse closes a connection that was just accepted. The notice, if any, is
+// shown to the user first, or sent as a rejected event to JSON clients.
+func refuse(ctx context.Context, conn *websocket.Conn, status websocket.StatusCode, reason, notice string) {
+	if notice != "" {
+		var buf bytes.Buffer
+		var err error
+		if conn.Subprotocol() == SubprotocolJSON {
+			err = json.NewEncoder(&buf).Encode(Event{Type: EventRejected, Data: NoticeEvent{Reason: notice}})
+		} else {
+			err = chat.ModerationNotice(notice).Render(ctx, &buf)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to render notice",
+				"error", err)
+		} else {
+			writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			if err := conn.Write(writeCtx, websocket.MessageText, buf.Bytes()); err != nil {
+				slog.WarnContext(ctx, "failed to write notice",
+					"error", err)
+			}
+			cancel()
+		}
+	}
+
+	if err := conn.Close(status, reason); err != nil {
+		slog.Warn("websocket connection closed", slog.Any("error", err),
+			slog.String("reason", status.String()))
+	}
+}
@@ -0,0 +1,180 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+)
+
+// serveUpgrader upgrades every request for the user and keeps the
+// connection open until the client closes it.
+func serveUpgrader(t *testing.T, u *Upgrader, userID uuid.UUID) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, release, err := u.Upgrade(w, r, userID)
+		if err != nil {
+			return
+		}
+		defer release()
+		for {
+			if _, _, err := conn.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestUpgradeSubprotocols(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	url := serveUpgrader(t, NewUpgrader(DefaultHandshake()), uuid.New())
+
+	tests := []struct {
+		name    string
+		offered []string
+		want    string
+		// closed is the close status of a refused connection.
+		closed websocket.StatusCode
+	}{
+		{"none", nil, "", -1},
+		{"html", []string{SubprotocolHTML}, SubprotocolHTML, -1},
+		{"json", []string{SubprotocolJSON}, SubprotocolJSON, -1},
+		{"preferred", []string{SubprotocolJSON, SubprotocolHTML}, SubprotocolHTML, -1},
+		{"unsupported", []string{"chatter.v0"}, "", websocket.StatusProtocolError},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{Subprotocols: tc.offered})
+			if err != nil {
+				t.Fatalf("Dial() error = %+v", err)
+			}
+			defer conn.CloseNow() //nolint:errcheck
+
+			if got := conn.Subprotocol(); got != tc.want {
+				t.Errorf("want subprotocol %q, got %q", tc.want, got)
+			}
+			if tc.closed == -1 {
+				return
+			}
+			if _, _, err := conn.Read(ctx); websocket.CloseStatus(err) != tc.closed {
+				t.Errorf("want close status %v, got %v", tc.closed, err)
+			}
+		})
+	}
+}
+
+func TestUpgradeOrigins(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	handshake := DefaultHandshake()
+	handshake.OriginPatterns = []string{"chat.example.com"}
+	url := serveUpgrader(t, NewUpgrader(handshake), uuid.New())
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://chat.example.com", true},
+		{"https://evil.example.com", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.origin, func(t *testing.T) {
+			conn, resp, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+				HTTPHeader: http.Header{"Origin": {tc.origin}},
+			})
+			if tc.want {
+				if err != nil {
+					t.Fatalf("Dial() error = %+v", err)
+				}
+				conn.CloseNow() //nolint:errcheck
+				return
+			}
+			if err == nil {
+				conn.CloseNow() //nolint:errcheck
+				t.Fatal("Dial() succeeded, want the origin refused")
+			}
+			if resp == nil || resp.StatusCode != http.StatusForbidden {
+				t.Errorf("want status %d, got %+v", http.StatusForbidden, resp)
+			}
+		})
+	}
+}
+
+func TestUpgradeConnectionCap(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	handshake := DefaultHandshake()
+	handshake.MaxPerUser = 2
+	upgrader := NewUpgrader(handshake)
+	userID := uuid.New()
+	url := serveUpgrader(t, upgrader, userID)
+
+	var conns []*websocket.Conn
+	for range handshake.MaxPerUser {
+		conn, _, err := websocket.Dial(ctx, url, nil)
+		if err != nil {
+			t.Fatalf("Dial() error = %+v", err)
+		}
+		defer conn.CloseNow() //nolint:errcheck
+		conns = append(conns, conn)
+	}
+
+	// The connection over the cap is told why, then closed.
+	refused, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %+v", err)
+	}
+	defer refused.CloseNow() //nolint:errcheck
+	if _, notice, err := refused.Read(ctx); err != nil || !strings.Contains(string(notice), "Too many open connections") {
+		t.Errorf("want a notice, got %q, %v", notice, err)
+	}
+	if _, _, err := refused.Read(ctx); websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Errorf("want close status %v, got %v", websocket.StatusPolicyViolation, err)
+	}
+
+	// Closing a connection makes room for another one.
+	if err := conns[0].Close(websocket.StatusNormalClosure, ""); err != nil {
+		t.Fatalf("Close() error = %+v", err)
+	}
+	for {
+		upgrader.mu.Lock()
+		open := upgrader.perUser[userID]
+		upgrader.mu.Unlock()
+		if open < handshake.MaxPerUser {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("the closed connection was not released")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	conn, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %+v", err)
+	}
+	defer conn.CloseNow() //nolint:errcheck
+
+	// Accepted connections stay open.
+	readCtx, cancelRead := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelRead()
+	if _, _, err := conn.Read(readCtx); websocket.CloseStatus(err) != -1 {
+		t.Errorf("want the connection accepted, got %v", err)
+	}
+}
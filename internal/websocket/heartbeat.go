@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// Clock tells the time to the heartbeat. Tests replace it with a fake one.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Heartbeat configures how dead and idle connections are detected.
+type Heartbeat struct {
+	// Interval is how often clients are pinged.
+	Interval time.Duration
+	// Timeout is how long a client has to answer a ping. Clients that do not
+	// are considered dead and unregistered.
+	Timeout time.Duration
+	// Idle is how long a client can go without sending anything before it is
+	// disconnected. Zero never disconnects idle clients.
+	Idle  time.Duration
+	Clock Clock
+}
+
+// DefaultHeartbeat pings clients every 30 seconds and disconnects them after
+// an hour without activity.
+func DefaultHeartbeat() Heartbeat {
+	return Heartbeat{
+		Interval: 30 * time.Second,
+		Timeout:  10 * time.Second,
+		Idle:     time.Hour,
+		Clock:    realClock{},
+	}
+}
+
+// touch records activity from the client.
+func (c *Client) touch() {
+	c.lastActive.Store(c.Hub.heartbeat.Clock.Now().UnixNano())
+}
+
+// Heartbeat pings the client until the connection is gone. Connections that
+// stop answering, or stay idle for too long, are closed; ReadMessage then
+// unregisters the client.
+func (c *Client) Heartbeat(ctx context.Context) {
+	hb := c.Hub.heartbeat
+	c.touch()
+
+	for {
+		select {
+		case <-hb.Clock.After(hb.Interval):
+		case <-ctx.Done():
+			return
+		}
+
+		lastActive := time.Unix(0, c.lastActive.Load())
+		if hb.Idle > 0 && hb.Clock.Now().Sub(lastActive) >= hb.Idle {
+			slog.InfoContext(ctx, "disconnecting idle client",
+				"user_id", c.UserID.String(),
+				"username", c.Username)
+			// Going away tells the browser not to reconnect.
+			if err := c.conn.Close(websocket.StatusGoingAway, "idle"); err != nil {
+				slog.Warn("websocket connection closed", slog.Any("error", err),
+					slog.String("reason", websocket.StatusGoingAway.String()))
+			}
+			return
+		}
+
+		// The pong is read by ReadMessage, which must be running.
+		pingCtx, cancel := context.WithCancel(ctx)
+		pong := make(chan error, 1)
+		go func() {
+			pong <- c.conn.Ping(pingCtx)
+		}()
+
+		var err error
+		select {
+		case err = <-pong:
+		case <-hb.Clock.After(hb.Timeout):
+			err = context.DeadlineExceeded
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.InfoContext(ctx, "reaping dead connection",
+				"error", err,
+				"user_id", c.UserID.String(),
+				"username", c.Username)
+			if err := c.conn.CloseNow(); err != nil {
+				slog.Warn("websocket connection closed", slog.Any("error", err))
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/johndosdos/chatter/internal/broker"
+)
+
+// fakeClock only moves forward when told to.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	// waiting receives a value every time After is called.
+	waiting chan struct{}
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		waiting: make(chan struct{}, 16),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	c.mu.Unlock()
+
+	c.waiting <- struct{}{}
+	return ch
+}
+
+// Advance moves the clock forward, firing the waiters due by then.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiters
+}
+
+// wait blocks until the heartbeat waits on the clock.
+func (c *fakeClock) wait(ctx context.Context, t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-c.waiting:
+	case <-ctx.Done():
+		t.Fatal("the heartbeat did not wait on the clock")
+	}
+}
+
+// runHeartbeat connects a client with a heartbeat driven by the fake clock.
+func runHeartbeat(t *testing.T, hb Heartbeat) (context.Context, *Hub, *Client, *websocket.Conn) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	hub := NewHub(nil, broker.NewMemory())
+	hub.SetHeartbeat(hb)
+	go hub.Run(ctx)
+
+	client, browser := connect(ctx, t, hub, "reader", Channel{RoomID: 1})
+	client.SetMessageLimiter(30, time.Minute)
+	client.SetTypingLimiter(30, time.Minute)
+	go client.ReadMessage(ctx)
+	go client.Heartbeat(ctx)
+
+	return ctx, hub, client, browser
+}
+
+// answerPings reads from the browser's end of the connection, which answers
+// the pings, until it is closed. It returns the close status.
+func answerPings(ctx context.Context, browser *websocket.Conn) <-chan websocket.StatusCode {
+	status := make(chan websocket.StatusCode, 1)
+	go func() {
+		for {
+			if _, _, err := browser.Read(ctx); err != nil {
+				status <- websocket.CloseStatus(err)
+				return
+			}
+		}
+	}()
+	return status
+}
+
+// waitUnregistered waits for the hub to unregister the client, which closes
+// its queue.
+func waitUnregistered(ctx context.Context, t *testing.T, client *Client) {
+	t.Helper()
+
+	for {
+		select {
+		case _, ok := <-client.MessageCh:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("the client was not unregistered")
+		}
+	}
+}
+
+func TestHeartbeatReapsDeadConnection(t *testing.T) {
+	clock := newFakeClock()
+	hb := Heartbeat{Interval: 30 * time.Second, Timeout: 10 * time.Second, Clock: clock}
+	// The browser never reads, so it never answers the pings.
+	ctx, hub, client, _ := runHeartbeat(t, hb)
+
+	clock.wait(ctx, t)
+	clock.Advance(hb.Interval)
+	clock.wait(ctx, t)
+	clock.Advance(hb.Timeout)
+
+	waitUnregistered(ctx, t, client)
+
+	metrics, err := hub.Metrics(ctx)
+	if err != nil {
+		t.Fatalf("Metrics() error = %+v", err)
+	}
+	if len(metrics) != 0 {
+		t.Errorf("want no client connected, got %+v", metrics)
+	}
+}
+
+func TestHeartbeatKeepsLiveConnection(t *testing.T) {
+	clock := newFakeClock()
+	hb := Heartbeat{Interval: 30 * time.Second, Timeout: 10 * time.Second, Clock: clock}
+	ctx, hub, _, browser := runHeartbeat(t, hb)
+	answerPings(ctx, browser)
+
+	for range 5 {
+		clock.wait(ctx, t)
+		clock.Advance(hb.Interval)
+		// The pong arrives before the timeout.
+		clock.wait(ctx, t)
+	}
+
+	metrics, err := hub.Metrics(ctx)
+	if err != nil {
+		t.Fatalf("Metrics() error = %+v", err)
+	}
+	if len(metrics) != 1 {
+		t.Errorf("want the client still connected, got %+v", metrics)
+	}
+}
+
+func TestHeartbeatDisconnectsIdleClient(t *testing.T) {
+	clock := newFakeClock()
+	hb := Heartbeat{Interval: 30 * time.Second, Timeout: 10 * time.Second, Idle: time.Minute, Clock: clock}
+	ctx, _, client, browser := runHeartbeat(t, hb)
+	closed := answerPings(ctx, browser)
+
+	// 30s: the client is not idle yet. It then sends a typing indicator.
+	clock.wait(ctx, t)
+	clock.Advance(hb.Interval)
+	clock.wait(ctx, t)
+
+	if err := browser.Write(ctx, websocket.MessageText, []byte(`{"HEADERS": {"HX-Trigger": "user-input"}}`)); err != nil {
+		t.Fatalf("Write() error = %+v", err)
+	}
+	for payload := range client.ephemeralCh {
+		if payload.Type == payloadTyping {
+			break
+		}
+	}
+
+	// 60s: the client was active 30s ago.
+	clock.wait(ctx, t)
+	clock.Advance(hb.Interval)
+	clock.wait(ctx, t)
+
+	// 90s: the client has been idle for a minute.
+	clock.wait(ctx, t)
+	clock.Advance(hb.Interval)
+
+	select {
+	case status := <-closed:
+		if status != websocket.StatusGoingAway {
+			t.Errorf("want close status %v, got %v", websocket.StatusGoingAway, status)
+		}
+	case <-ctx.Done():
+		t.Fatal("the idle client was not disconnected")
+	}
+	waitUnregistered(ctx, t, client)
+}
@@ -2,131 +2,1055 @@ package websocket
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/coder/websocket"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/johndosdos/chatter/components/chat"
+	"github.com/johndosdos/chatter/internal/audit"
+	"github.com/johndosdos/chatter/internal/auth"
+	"github.com/johndosdos/chatter/internal/broker"
 	"github.com/johndosdos/chatter/internal/database"
+	"github.com/johndosdos/chatter/internal/filter"
 	"github.com/johndosdos/chatter/internal/model"
 	"github.com/microcosm-cc/bluemonday"
 )
 
+// ErrUndelivered is returned when a change was applied but could not be
+// sent to the users.
+var ErrUndelivered = errors.New("internal/websocket: not delivered")
+
+// ErrBusy is returned when the hub has too much queued to take a request.
+var ErrBusy = errors.New("internal/websocket: hub busy")
+
+// errForbidden is returned when the user's role does not allow the change.
+var errForbidden = errors.New("not allowed")
+
+// outboundQueueSize bounds the payloads posted by the main loop that wait
+// for the broker.
+const outboundQueueSize = 1024
+
+// requestTimeout bounds how long Kick, Mute, Leave and DeleteMessage wait
+// for the hub.
+const requestTimeout = 5 * time.Second
+
+// hubRequest is a payload applied by runChanges. Payloads sent on behalf of
+// a user from outside the chat, such as moderation actions, have their
+// outcome reported on done.
+type hubRequest struct {
+	payload model.ChatMessage
+	done    chan error
+}
+
 type sanitizer interface {
 	Sanitize(s string) string
 	SanitizeBytes(p []byte) []byte
 }
 
+const (
+	// maxMentions caps the number of users a single message can mention.
+	maxMentions = 20
+
+	// maxPins caps the number of messages pinned to a channel.
+	maxPins = 20
+)
+
 type Registration struct {
 	Client *Client
 	Done   chan struct{}
 }
 
 type Hub struct {
-	db *database.Queries
-	// jetstream  jetstream.JetStream
-	clients    map[uuid.UUID]*Client
-	Register   chan Registration
-	Unregister chan *Client
-	ClientMsg  chan model.ChatMessage
-	// BrokerMsg  chan model.ChatMessage
+	db     *database.Queries
+	broker broker.Broker
+	// instanceID tells our own broker events apart from the ones published
+	// by other chatter instances.
+	instanceID string
+	// channels groups the connected clients by the room or conversation they
+	// joined, then by user. A user may have several connections (tabs,
+	// devices) to the same channel. Payloads are only fanned out to the
+	// clients of the payload's channel, so direct messages only reach the two
+	// participants.
+	channels map[Channel]map[uuid.UUID]map[*Client]struct{}
+	// remotePresence holds the users connected to every other instance, per
+	// channel.
+	remotePresence map[string]map[Channel]map[uuid.UUID]struct{}
+	Register       chan Registration
+	Unregister     chan *Client
+	ClientMsg      chan model.ChatMessage
+	// receipts feeds runReceipts, keeping acks out of ClientMsg.
+	receipts chan receiptUpdate
+	// persist feeds runPersist, keeping the storage of new messages out of
+	// the main loop.
+	persist chan model.ChatMessage
+	// changes feeds runChanges, keeping every other database write out of
+	// the main loop.
+	changes chan hubRequest
+	// outbound feeds runOutbound with the payloads published by the main
+	// loop, so that it never waits on the broker.
+	outbound chan model.ChatMessage
+	// local delivers the notices that could not go through the broker to
+	// our own clients.
+	local     chan model.ChatMessage
 	sanitizer sanitizer
+	// filters checks the content of messages and edits. Other payloads are
+	// only sanitized.
+	filters   filter.Chain
+	heartbeat Heartbeat
+	// slow holds the clients that fell too far behind, to be disconnected.
+	slow       []*Client
+	metricsReq chan chan []ClientMetrics
+	requests   chan hubRequest
 }
 
 func (h *Hub) Run(ctx context.Context) {
-	/* 	err := broker.Subscriber(ctx, stream, h.BrokerMsg)
-	   	if err != nil {
-	   		log.Printf("failed to subscribe to broker: %v", err)
-	   	} */
+	// Every event goes through the broker, including our own. Clients are
+	// only written to when an event comes back from the broker, so every
+	// instance delivers the same events.
+	brokerMsg, err := h.broker.Subscribe(ctx)
+	if err != nil {
+		log.Printf("failed to subscribe to broker: %v", err)
+		return
+	}
+
+	go h.runReceipts(ctx)
+	go h.runOutbound(ctx)
+	var workers sync.WaitGroup
+	workers.Go(func() { h.runPersist(ctx) })
+	workers.Go(func() { h.runChanges(ctx) })
+
+	// Ask the other instances for their presence counts; they only announce
+	// them on changes otherwise.
+	h.post(model.ChatMessage{Type: payloadPresenceSync})
 
 	for {
+		h.evictSlow(ctx)
+
 		select {
 		case reg := <-h.Register:
 			client := reg.Client
-			h.clients[client.UserID] = client
+			users, ok := h.channels[client.Channel]
+			if !ok {
+				users = make(map[uuid.UUID]map[*Client]struct{})
+				h.channels[client.Channel] = users
+			}
+			conns, ok := users[client.UserID]
+			if !ok {
+				conns = make(map[*Client]struct{})
+				users[client.UserID] = conns
+				// Other instances only care about the user's first connection.
+				h.announcePresence(client.Channel, client.UserID, payloadUserJoined)
+			}
+			conns[client] = struct{}{}
 			client.Hub = h
-			h.connectedUsers()
+			h.broadcastPresence(client.Channel)
 			close(reg.Done)
 
 		case client := <-h.Unregister:
-			delete(h.clients, client.UserID)
-			h.connectedUsers()
-			close(client.MessageCh)
+			// Slow clients were already removed.
+			if h.removeClient(client) {
+				close(client.MessageCh)
+			}
 
-		case payload := <-h.ClientMsg:
-			// We need to sanitize incoming messages to prevent XSS.
-			sanitized := h.sanitizer.Sanitize(payload.Content)
-			payload.Content = sanitized
-
-			/* 			// If the message is a typing indicator, we don't need to persist it.
-			   			if payload.Type == "typing" {
-			   				err := broker.Publisher(ctx, h.jetstream, payload)
-			   				if err != nil {
-			   					log.Printf("%v", err)
-			   				}
-			   				continue
-			   			} */
-
-			message := database.CreateMessageParams{
-				UserID:  pgtype.UUID{Bytes: [16]byte(payload.UserID), Valid: true},
-				Content: string(payload.Content),
-				CreatedAt: pgtype.Timestamptz{
-					Time:             payload.CreatedAt,
-					InfinityModifier: 0,
-					Valid:            true,
-				},
-			}
-
-			// If payload.Type is 'typing', try not to create an entry in the database.
-			if payload.Type == "message" {
-				createdMsg, err := h.db.CreateMessage(ctx, message)
-				if err != nil {
-					log.Printf("failed to store payload to database: %v", err)
-					continue
+		case reply := <-h.metricsReq:
+			var metrics []ClientMetrics
+			for _, users := range h.channels {
+				for _, conns := range users {
+					for client := range conns {
+						metrics = append(metrics, client.Metrics())
+					}
 				}
-				payload.ID = createdMsg.ID
-				payload.CreatedAt = createdMsg.CreatedAt.Time
+			}
+			reply <- metrics
+
+		case payload := <-h.ClientMsg:
+			switch payload.Type {
+			case payloadMessage:
+				// New messages are filtered, stored and published by runPersist.
+				h.queueMessage(ctx, payload)
+			case payloadTyping:
+				// Typing indicators never touch the database.
+				payload.Content = h.sanitizer.Sanitize(payload.Content)
+				h.post(payload)
+			default:
+				h.queueChange(ctx, hubRequest{payload: payload})
 			}
 
-			/* 			err = broker.Publisher(ctx, h.jetstream, payload)
-			   			if err != nil {
-			   				log.Printf("%v", err)
-			   				continue
-			   			} */
+		case req := <-h.requests:
+			h.queueChange(ctx, req)
 
-			for _, client := range h.clients {
-				client.MessageCh <- payload
+		case payload := <-h.local:
+			h.dispatch(ctx, payload)
+
+		case payload, ok := <-brokerMsg:
+			if !ok {
+				log.Printf("broker subscription closed: %v", ctx.Err())
+				return
 			}
+			h.dispatch(ctx, payload)
 
 		case <-ctx.Done():
 			log.Printf("context cancelled: %v", ctx.Err())
+
+			// Let the other instances drop our users from their presence counts.
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			for channel, users := range h.channels {
+				for userID := range users {
+					_ = h.publish(shutdownCtx, presenceEvent(channel, userID, payloadUserLeft))
+				}
+			}
+
+			// Nothing is queued past this point. Wait for the queued messages
+			// and changes to be stored.
+			close(h.persist)
+			close(h.changes)
+			stopped := make(chan struct{})
+			go func() {
+				workers.Wait()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-shutdownCtx.Done():
+				log.Printf("gave up storing queued messages: %v", shutdownCtx.Err())
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// removeClient removes a single connection. The user's other connections
+// keep receiving broadcasts. It reports false if the client was not
+// registered.
+func (h *Hub) removeClient(client *Client) bool {
+	users := h.channels[client.Channel]
+	conns := users[client.UserID]
+	if _, ok := conns[client]; !ok {
+		return false
+	}
+	delete(conns, client)
+	if len(conns) == 0 {
+		delete(users, client.UserID)
+		h.announcePresence(client.Channel, client.UserID, payloadUserLeft)
+	}
+	if len(users) == 0 {
+		delete(h.channels, client.Channel)
+	}
+	h.broadcastPresence(client.Channel)
+
+	return true
+}
+
+// send queues the payload for the client without ever blocking the hub.
+// Typing indicators and presence counts make room by dropping the oldest
+// ones queued. Every other payload must reach the client, so a client too
+// far behind to queue it is disconnected instead; the browser reconnects and
+// loads the messages it missed.
+func (h *Hub) send(client *Client, payload model.ChatMessage) {
+	if client.slow {
+		return
+	}
+	if payload.Type == payloadTyping || payload.Type == payloadPresenceCount {
+		client.sendEphemeral(payload)
+		return
+	}
+	if !client.trySend(payload) {
+		client.slow = true
+		h.slow = append(h.slow, client)
+	}
+}
+
+// evictSlow disconnects the clients that fell too far behind. It runs
+// outside of the broadcasts, which must not change the clients they range
+// over.
+func (h *Hub) evictSlow(ctx context.Context) {
+	for _, client := range h.slow {
+		if !h.removeClient(client) {
+			continue
+		}
+		slog.WarnContext(ctx, "disconnecting slow client",
+			"user_id", client.UserID.String(),
+			"username", client.Username,
+			"metrics", client.Metrics())
+
+		// MessageCh is left open, since ReadMessage may still be sending to
+		// the client. WriteMessage stops once the connection is gone.
+		//
+		// Try again later tells the browser to reconnect.
+		go func() {
+			if err := client.conn.Close(websocket.StatusTryAgainLater, "slow consumer"); err != nil {
+				slog.Warn("websocket connection closed", slog.Any("error", err),
+					slog.String("reason", websocket.StatusTryAgainLater.String()))
+			}
+		}()
+	}
+	h.slow = h.slow[:0]
+}
+
+// Metrics returns the queue metrics of every client connected to this
+// instance.
+func (h *Hub) Metrics(ctx context.Context) ([]ClientMetrics, error) {
+	reply := make(chan []ClientMetrics, 1)
+	select {
+	case h.metricsReq <- reply:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case metrics := <-reply:
+		return metrics, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SetFilters replaces the content filters. It must be called before Run.
+func (h *Hub) SetFilters(filters filter.Chain) {
+	h.filters = filters
+}
+
+// SetHeartbeat replaces the heartbeat of the clients. It must be called
+// before Run.
+func (h *Hub) SetHeartbeat(heartbeat Heartbeat) {
+	h.heartbeat = heartbeat
+}
+
+// flagMessage reports a message flagged by the content filters to the
+// moderators. A message has at most one open report from the filters.
+func (h *Hub) flagMessage(ctx context.Context, messageID int64, flags []string) error {
+	_, err := h.db.CreateReport(ctx, database.CreateReportParams{
+		MessageID: messageID,
+		Reason:    strings.Join(flags, " "),
+	})
+	return err
+}
+
+// Kick closes every connection of the user, on every chatter instance, and
+// shows them the reason.
+func (h *Hub) Kick(ctx context.Context, userID uuid.UUID, reason string) error {
+	return h.do(ctx, model.ChatMessage{
+		UserID:  userID,
+		Content: reason,
+		Type:    payloadKick,
+	})
+}
+
+// Mute stops the user from sending anything until the given time. The zero
+// time lifts the mute.
+func (h *Hub) Mute(ctx context.Context, userID uuid.UUID, until time.Time, reason string) error {
+	return h.do(ctx, model.ChatMessage{
+		UserID:  userID,
+		Content: reason,
+		Until:   until,
+		Type:    payloadMute,
+	})
+}
+
+// Leave disconnects the user from the channel, once they are no longer one
+// of its members.
+func (h *Hub) Leave(ctx context.Context, userID uuid.UUID, channel Channel) error {
+	return h.do(ctx, model.ChatMessage{
+		RoomID:         channel.RoomID,
+		ConversationID: channel.ConversationID,
+		UserID:         userID,
+		Content:        "You left this room.",
+		Type:           payloadLeave,
+	})
+}
+
+// DeleteMessage deletes a message of the channel on behalf of the user, as
+// if they had deleted it from the chat. The hub checks that the user may do
+// so. Once the message is deleted, only ErrUndelivered can be returned.
+func (h *Hub) DeleteMessage(ctx context.Context, userID uuid.UUID, channel Channel, messageID int64) error {
+	return h.do(ctx, model.ChatMessage{
+		ID:             messageID,
+		RoomID:         channel.RoomID,
+		ConversationID: channel.ConversationID,
+		UserID:         userID,
+		CreatedAt:      time.Now().UTC(),
+		Type:           payloadDelete,
+	})
+}
+
+// do hands a payload sent from outside the chat over to the main loop, and
+// waits for the outcome. It gives up after requestTimeout, so that a busy
+// hub never holds up a request for long.
+func (h *Hub) do(ctx context.Context, payload model.ChatMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req := hubRequest{payload: payload, done: make(chan error, 1)}
+	select {
+	case h.requests <- req:
+	case <-ctx.Done():
+		return fmt.Errorf("internal/websocket: hub busy: %w", ctx.Err())
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("internal/websocket: hub busy: %w", ctx.Err())
+	}
+}
+
+// handle applies a payload other than a new message, then publishes the
+// result. Failures are logged before they are returned. It runs on
+// runChanges, never on the main loop, since it waits on the database and
+// the broker.
+func (h *Hub) handle(ctx context.Context, payload model.ChatMessage) error {
+	request := payload
+
+	// We need to sanitize incoming messages to prevent XSS. Edits are
+	// sanitized by the content filters, which may also rewrite, reject or
+	// flag them.
+	var flags []string
+	if payload.Type == payloadEdit {
+		var ok bool
+		payload, flags, ok = h.filterContent(ctx, payload)
+		if !ok {
+			return nil
+		}
+	} else {
+		payload.Content = h.sanitizer.Sanitize(payload.Content)
+	}
+
+	switch payload.Type {
+	case payloadEdit, payloadDelete:
+		updated, err := h.updateMessage(ctx, payload)
+		if err != nil {
+			log.Printf("failed to %s message %d: %v", payload.Type, payload.ID, err)
+			return err
+		}
+		payload = updated
+
+		if err := h.refreshPins(ctx, payload); err != nil {
+			log.Printf("failed to refresh pins of message %d: %v", payload.ID, err)
+		}
+
+		if payload.Deleted && payload.ParentID != 0 {
+			// Deleted replies no longer count towards their thread.
+			thread, err := h.threadSummary(ctx, payload.ParentID)
+			if err != nil {
+				log.Printf("failed to summarize thread %d: %v", payload.ParentID, err)
+			}
+			payload.Thread = thread
+		}
+
+	case payloadRead:
+		updated, err := h.markRead(ctx, payload)
+		if err != nil {
+			log.Printf("failed to mark message %d as read: %v", payload.ID, err)
+			return err
+		}
+		payload = updated
+
+	case payloadReact:
+		updated, err := h.toggleReaction(ctx, payload)
+		if err != nil {
+			log.Printf("failed to react to message %d: %v", payload.ID, err)
+			return err
+		}
+		payload = updated
+
+	case payloadPin, payloadUnpin:
+		updated, err := h.pinMessage(ctx, payload)
+		if err != nil {
+			log.Printf("failed to %s message %d: %v", payload.Type, payload.ID, err)
+			if errors.Is(err, errForbidden) {
+				h.reject(ctx, request, noticePinForbidden)
+			}
+			return err
+		}
+		payload = updated
+	}
+
+	if len(flags) > 0 {
+		if err := h.flagMessage(ctx, payload.ID, flags); err != nil {
+			log.Printf("failed to flag message %d: %v", payload.ID, err)
+		}
+	}
+
+	if err := h.publish(ctx, payload); err != nil {
+		switch request.Type {
+		case payloadEdit, payloadDelete, payloadReact, payloadPin, payloadUnpin:
+			h.reject(ctx, request, noticeUndelivered)
+		}
+		return fmt.Errorf("%w: %w", ErrUndelivered, err)
+	}
+
+	return nil
+}
+
+// channelMessage returns the message targeted by the payload. It must
+// belong to the channel the user is connected to and not be deleted.
+func (h *Hub) channelMessage(ctx context.Context, payload model.ChatMessage) (database.Message, error) {
+	stored, err := h.db.GetMessage(ctx, payload.ID)
+	if err != nil {
+		return stored, err
+	}
+
+	if stored.RoomID.Int64 != payload.RoomID || stored.ConversationID.Int64 != payload.ConversationID {
+		return stored, errors.New("message belongs to another channel")
+	}
+	if stored.DeletedAt.Valid {
+		return stored, errors.New("message is deleted")
+	}
+
+	return stored, nil
+}
+
+// updateMessage applies an edit or deletion to the stored message and
+// returns the payload to broadcast. Users can only change their own messages
+// in the channel they are connected to; moderators can also delete the
+// messages of other users.
+func (h *Hub) updateMessage(ctx context.Context, payload model.ChatMessage) (model.ChatMessage, error) {
+	stored, err := h.channelMessage(ctx, payload)
+	if err != nil {
+		return payload, err
+	}
+
+	// moderator is set when a moderator deletes the message of another user.
+	var moderator uuid.UUID
+	if author := uuid.UUID(stored.UserID.Bytes); author != payload.UserID {
+		if payload.Type == payloadEdit {
+			return payload, errors.New("message belongs to another user")
+		}
+		if err := h.checkRole(ctx, payload.UserID, auth.RoleModerator); err != nil {
+			return payload, err
+		}
+		moderator = payload.UserID
+		// The update is rendered for the author, not for the moderator.
+		payload.UserID = author
+	}
+
+	if payload.Type == payloadEdit {
+		if strings.TrimSpace(payload.Content) == "" {
+			return payload, errors.New("empty content")
+		}
+		stored, err = h.db.UpdateMessageContent(ctx, database.UpdateMessageContentParams{
+			ID:      payload.ID,
+			Content: payload.Content,
+		})
+	} else {
+		stored, err = h.db.DeleteMessage(ctx, payload.ID)
+	}
+	if err != nil {
+		return payload, err
+	}
+	if moderator != uuid.Nil {
+		audit.Record(ctx, h.db, audit.Event{
+			Name:     audit.EventMessageDeleted,
+			ActorID:  moderator,
+			TargetID: payload.UserID,
+			Metadata: map[string]any{"message_id": payload.ID},
+		})
+	}
+
+	payload.Content = stored.Content
+	payload.CreatedAt = stored.CreatedAt.Time
+	payload.Edited = stored.EditedAt.Valid
+	payload.Deleted = stored.DeletedAt.Valid
+	payload.ParentID = stored.ParentID.Int64
+
+	// Mentions follow the new content. Edits do not notify anyone again.
+	if err := h.db.DeleteMentions(ctx, payload.ID); err != nil {
+		return payload, err
+	}
+	if !payload.Deleted {
+		payload.Mentions, err = h.storeMentions(ctx, payload)
+		if err != nil {
+			return payload, err
+		}
+	}
+
+	return payload, nil
+}
+
+// checkRole ensures the user holds the given role or a role above it. Roles
+// are read from the database so that role changes apply to connected users
+// immediately.
+func (h *Hub) checkRole(ctx context.Context, userID uuid.UUID, role auth.Role) error {
+	userRole, err := h.db.GetUserRole(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return err
+	}
+	if !auth.Role(userRole).AtLeast(role) {
+		return fmt.Errorf("%w: user is not a %s", errForbidden, role)
+	}
+
+	return nil
+}
+
+// storeMentions resolves the users mentioned in a message and stores them.
+// Only the users who can read the message's channel can be mentioned.
+func (h *Hub) storeMentions(ctx context.Context, payload model.ChatMessage) ([]model.Mention, error) {
+	usernames := model.ParseMentions(payload.Content)
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	if len(usernames) > maxMentions {
+		usernames = usernames[:maxMentions]
+	}
+
+	rows, err := h.db.ResolveMentions(ctx, database.ResolveMentionsParams{
+		Usernames:      usernames,
+		RoomID:         payload.RoomID,
+		ConversationID: payload.ConversationID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mentions := make([]model.Mention, 0, len(rows))
+	for _, row := range rows {
+		err := h.db.CreateMention(ctx, database.CreateMentionParams{
+			MessageID: payload.ID,
+			UserID:    row.UserID,
+		})
+		if err != nil {
+			return mentions, err
+		}
+		mentions = append(mentions, model.Mention{UserID: row.UserID.Bytes, Username: row.Username})
+	}
+
+	return mentions, nil
+}
+
+// notifyMentions sends a notification to every connection of the users
+// mentioned in a new message, whichever channel they are connected to.
+func (h *Hub) notifyMentions(payload model.ChatMessage) {
+	notification := payload
+	notification.Type = payloadMention
+	for _, mention := range payload.Mentions {
+		if mention.UserID == payload.UserID {
+			continue
+		}
+		for _, users := range h.channels {
+			for client := range users[mention.UserID] {
+				h.send(client, notification)
+			}
+		}
+	}
+}
+
+// markRead moves the user's read marker forward to the message and returns
+// the payload to send to the user's connections, holding the new marker and
+// the number of messages left unread.
+func (h *Hub) markRead(ctx context.Context, payload model.ChatMessage) (model.ChatMessage, error) {
+	stored, err := h.db.GetMessage(ctx, payload.ID)
+	if err != nil {
+		return payload, err
+	}
+	if stored.RoomID.Int64 != payload.RoomID || stored.ConversationID.Int64 != payload.ConversationID {
+		return payload, errors.New("message belongs to another channel")
+	}
+
+	userID := pgtype.UUID{Bytes: payload.UserID, Valid: true}
+	roomID := pgtype.Int8{Int64: payload.RoomID, Valid: payload.RoomID != 0}
+	conversationID := pgtype.Int8{Int64: payload.ConversationID, Valid: payload.ConversationID != 0}
+
+	prevRead, err := h.db.GetReadMarker(ctx, database.GetReadMarkerParams{
+		UserID:         userID,
+		RoomID:         roomID,
+		ConversationID: conversationID,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return payload, err
+	}
+
+	lastRead, err := h.db.MarkRead(ctx, database.MarkReadParams{
+		UserID:         userID,
+		RoomID:         roomID,
+		ConversationID: conversationID,
+		LastReadID:     payload.ID,
+	})
+	if err != nil {
+		return payload, err
+	}
+
+	unread, err := h.db.CountUnread(ctx, database.CountUnreadParams{
+		RoomID:         roomID,
+		ConversationID: conversationID,
+		LastReadID:     lastRead,
+		UserID:         userID,
+	})
+	if err != nil {
+		return payload, err
+	}
+
+	h.queueReceipt(receiptUpdate{
+		userID:    payload.UserID,
+		channel:   Channel{RoomID: payload.RoomID, ConversationID: payload.ConversationID},
+		readAfter: prevRead,
+		readUpTo:  lastRead,
+	})
+
+	payload.ID = lastRead
+	payload.Content = strconv.FormatInt(unread, 10)
+
+	return payload, nil
+}
+
+// checkThread ensures a reply targets a message of the user's channel that
+// can start a thread.
+func (h *Hub) checkThread(ctx context.Context, payload model.ChatMessage) error {
+	parent, err := h.channelMessage(ctx, model.ChatMessage{
+		ID:             payload.ParentID,
+		RoomID:         payload.RoomID,
+		ConversationID: payload.ConversationID,
+	})
+	if err != nil {
+		return err
+	}
+	if parent.ParentID.Valid {
+		return errors.New("replies cannot start a thread")
+	}
+
+	return nil
+}
+
+// threadSummary counts the replies to a message and previews the latest one.
+// Deleted replies are left out of both, as they are from the thread pane.
+func (h *Hub) threadSummary(ctx context.Context, parentID int64) (model.Thread, error) {
+	rows, err := h.db.ListThreadSummaries(ctx, []int64{parentID})
+	if err != nil || len(rows) == 0 {
+		return model.Thread{}, err
+	}
+
+	return model.Thread{
+		Replies:  int(rows[0].Replies),
+		Username: rows[0].Username,
+		Content:  rows[0].Content,
+	}, nil
+}
+
+// toggleReaction adds the user's reaction to a message, or removes it when
+// it is already there. It returns the payload to broadcast, holding all the
+// reactions to the message.
+func (h *Hub) toggleReaction(ctx context.Context, payload model.ChatMessage) (model.ChatMessage, error) {
+	if !slices.Contains(chat.ReactionEmojis, payload.Content) {
+		return payload, errors.New("unsupported emoji")
+	}
+
+	if _, err := h.channelMessage(ctx, payload); err != nil {
+		return payload, err
+	}
+
+	reaction := database.AddReactionParams{
+		MessageID: payload.ID,
+		UserID:    pgtype.UUID{Bytes: payload.UserID, Valid: true},
+		Emoji:     payload.Content,
+	}
+	added, err := h.db.AddReaction(ctx, reaction)
+	if err != nil {
+		return payload, err
+	}
+	if added == 0 {
+		if _, err := h.db.RemoveReaction(ctx, database.RemoveReactionParams(reaction)); err != nil {
+			return payload, err
+		}
+	}
+
+	rows, err := h.db.ListReactions(ctx, []int64{payload.ID})
+	if err != nil {
+		return payload, err
+	}
+
+	payload.Reactions = make([]model.Reaction, 0, len(rows))
+	for _, row := range rows {
+		userIDs := make([]uuid.UUID, 0, len(row.Users))
+		for _, user := range row.Users {
+			userIDs = append(userIDs, user.Bytes)
+		}
+		payload.Reactions = append(payload.Reactions, model.Reaction{
+			Emoji:   row.Emoji,
+			UserIDs: userIDs,
+		})
+	}
+
+	return payload, nil
+}
+
+// pinMessage pins or unpins a message of the user's channel. It returns the
+// payload to broadcast, holding every pinned message of the channel.
+//
+// Authors can pin their own messages; moderators can pin any message.
+func (h *Hub) pinMessage(ctx context.Context, payload model.ChatMessage) (model.ChatMessage, error) {
+	stored, err := h.channelMessage(ctx, payload)
+	if err != nil {
+		return payload, err
+	}
+	if stored.ParentID.Valid {
+		return payload, errors.New("replies cannot be pinned")
+	}
+
+	if uuid.UUID(stored.UserID.Bytes) != payload.UserID {
+		if err := h.checkRole(ctx, payload.UserID, auth.RoleModerator); err != nil {
+			return payload, err
+		}
+	}
+
+	if payload.Type == payloadUnpin {
+		if _, err := h.db.UnpinMessage(ctx, payload.ID); err != nil {
+			return payload, err
+		}
+		return h.pins(ctx, payload)
+	}
+
+	pins, err := h.pins(ctx, payload)
+	if err != nil {
+		return payload, err
+	}
+	if len(pins.Pins) >= maxPins {
+		return payload, errors.New("too many pinned messages")
+	}
+
+	_, err = h.db.PinMessage(ctx, database.PinMessageParams{
+		MessageID: payload.ID,
+		PinnedBy:  pgtype.UUID{Bytes: payload.UserID, Valid: true},
+	})
+	if err != nil {
+		return payload, err
+	}
+
+	return h.pins(ctx, payload)
+}
+
+// refreshPins broadcasts the pinned messages of the channel again after a
+// pinned message is edited or deleted. Deleted messages are unpinned.
+func (h *Hub) refreshPins(ctx context.Context, payload model.ChatMessage) error {
+	pinned, err := h.db.IsPinned(ctx, payload.ID)
+	if err != nil || !pinned {
+		return err
+	}
+
+	if payload.Deleted {
+		if _, err := h.db.UnpinMessage(ctx, payload.ID); err != nil {
+			return err
+		}
+	}
+
+	pins, err := h.pins(ctx, payload)
+	if err != nil {
+		return err
+	}
+	h.publish(ctx, pins)
+
+	return nil
+}
+
+// pins returns the payload holding every pinned message of the payload's
+// channel.
+func (h *Hub) pins(ctx context.Context, payload model.ChatMessage) (model.ChatMessage, error) {
+	rows, err := h.db.ListPins(ctx, database.ListPinsParams{
+		RoomID:         pgtype.Int8{Int64: payload.RoomID, Valid: payload.RoomID != 0},
+		ConversationID: pgtype.Int8{Int64: payload.ConversationID, Valid: payload.ConversationID != 0},
+	})
+	if err != nil {
+		return payload, err
+	}
+
+	pins := make([]model.Pin, 0, len(rows))
+	for _, row := range rows {
+		pins = append(pins, model.Pin{
+			MessageID: row.ID,
+			Username:  row.Username,
+			Content:   row.Content,
+		})
+	}
+
+	return model.ChatMessage{
+		RoomID:         payload.RoomID,
+		ConversationID: payload.ConversationID,
+		Pins:           pins,
+		Type:           payloadPins,
+	}, nil
+}
+
+// publish stamps the payload with our instance ID and hands it over to the
+// broker. It waits on the broker, so the main loop posts its payloads
+// instead.
+func (h *Hub) publish(ctx context.Context, payload model.ChatMessage) error {
+	payload.Origin = h.instanceID
+	if err := h.broker.Publish(ctx, payload); err != nil {
+		log.Printf("failed to publish %s payload to broker: %v", payload.Type, err)
+		return err
+	}
+	return nil
+}
+
+// runOutbound publishes the payloads posted by the main loop, in order.
+// Failures are logged by publish; typing indicators and presence
+// announcements are not worth retrying.
+func (h *Hub) runOutbound(ctx context.Context) {
+	for {
+		select {
+		case payload := <-h.outbound:
+			_ = h.publish(ctx, payload)
+
+		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (h *Hub) connectedUsers() {
-	// Retrieve connected users through the clients table.
+// post queues a payload for runOutbound without ever blocking the main
+// loop. The payload is dropped when the queue is full.
+func (h *Hub) post(payload model.ChatMessage) {
+	select {
+	case h.outbound <- payload:
+	default:
+		log.Printf("outbound queue full, dropping %s payload", payload.Type)
+	}
+}
+
+// dispatch handles an event received from the broker.
+func (h *Hub) dispatch(ctx context.Context, payload model.ChatMessage) {
+	channel := Channel{RoomID: payload.RoomID, ConversationID: payload.ConversationID}
+
+	switch payload.Type {
+	case payloadUserJoined, payloadUserLeft:
+		// Our own users are always known locally.
+		if payload.Origin == h.instanceID {
+			return
+		}
+
+		channels, ok := h.remotePresence[payload.Origin]
+		if !ok {
+			channels = make(map[Channel]map[uuid.UUID]struct{})
+			h.remotePresence[payload.Origin] = channels
+		}
+		users, ok := channels[channel]
+		if !ok {
+			users = make(map[uuid.UUID]struct{})
+			channels[channel] = users
+		}
+
+		if payload.Type == payloadUserJoined {
+			users[payload.UserID] = struct{}{}
+		} else {
+			delete(users, payload.UserID)
+			if len(users) == 0 {
+				delete(channels, channel)
+			}
+			if len(channels) == 0 {
+				delete(h.remotePresence, payload.Origin)
+			}
+		}
+		h.broadcastPresence(channel)
+
+	case payloadPresenceSync:
+		if payload.Origin == h.instanceID {
+			return
+		}
+		for channel, users := range h.channels {
+			for userID := range users {
+				h.announcePresence(channel, userID, payloadUserJoined)
+			}
+		}
+
+	case payloadRead, payloadRejected, payloadLeave:
+		for client := range h.channels[channel][payload.UserID] {
+			h.send(client, payload)
+		}
+
+	case payloadKick, payloadMute:
+		// Sanctions apply to the user in every channel.
+		for _, users := range h.channels {
+			for client := range users[payload.UserID] {
+				h.send(client, payload)
+			}
+		}
+
+	default:
+		h.broadcast(channel, payload)
+		if payload.Type == payloadMessage {
+			h.notifyMentions(payload)
+		}
+	}
+}
+
+// broadcast sends the payload to every connection of every user in the
+// channel.
+func (h *Hub) broadcast(channel Channel, payload model.ChatMessage) {
+	for _, conns := range h.channels[channel] {
+		for client := range conns {
+			h.send(client, payload)
+		}
+	}
+}
+
+// announcePresence tells the other instances that a user joined or left a
+// channel through this instance.
+func (h *Hub) announcePresence(channel Channel, userID uuid.UUID, payloadType string) {
+	h.post(presenceEvent(channel, userID, payloadType))
+}
+
+// presenceEvent returns the payload announcing that a user joined or left a
+// channel.
+func presenceEvent(channel Channel, userID uuid.UUID, payloadType string) model.ChatMessage {
+	return model.ChatMessage{
+		RoomID:         channel.RoomID,
+		ConversationID: channel.ConversationID,
+		UserID:         userID,
+		Type:           payloadType,
+	}
+}
+
+func (h *Hub) broadcastPresence(channel Channel) {
+	// Count the unique users connected to the channel, through this instance
+	// or any other. A user with several connections is only counted once.
 	// Send HTML fragment to client through websockets and do OOB swap thereafter.
-	// Remember to send the data through the client.MessageCh. DO NOT CREATE A WRITER.
-	userSize := len(h.clients)
-	for _, client := range h.clients {
-		client.MessageCh <- model.ChatMessage{
-			Content: strconv.Itoa(userSize),
-			Type:    "presenceCount",
+	// Remember to send the data through h.send. DO NOT CREATE A WRITER.
+	users := h.channels[channel]
+	userSize := len(users)
+
+	remoteUsers := make(map[uuid.UUID]struct{})
+	for _, channels := range h.remotePresence {
+		for userID := range channels[channel] {
+			if _, ok := users[userID]; !ok {
+				remoteUsers[userID] = struct{}{}
+			}
 		}
 	}
+	userSize += len(remoteUsers)
+
+	h.broadcast(channel, model.ChatMessage{
+		Content: strconv.Itoa(userSize),
+		Type:    payloadPresenceCount,
+	})
 }
 
-func NewHub(db *database.Queries) *Hub {
+func NewHub(db *database.Queries, b broker.Broker) *Hub {
 	return &Hub{
-		db: db,
-		// jetstream:  js,
-		clients:    make(map[uuid.UUID]*Client),
-		Register:   make(chan Registration),
-		Unregister: make(chan *Client),
-		ClientMsg:  make(chan model.ChatMessage, 1024),
-		// BrokerMsg:  make(chan model.ChatMessage, 1024),
-		sanitizer: bluemonday.StrictPolicy(),
+		db:             db,
+		broker:         b,
+		instanceID:     uuid.NewString(),
+		channels:       make(map[Channel]map[uuid.UUID]map[*Client]struct{}),
+		remotePresence: make(map[string]map[Channel]map[uuid.UUID]struct{}),
+		Register:       make(chan Registration),
+		Unregister:     make(chan *Client),
+		ClientMsg:      make(chan model.ChatMessage, 1024),
+		receipts:       make(chan receiptUpdate, 1024),
+		persist:        make(chan model.ChatMessage, persistQueueSize),
+		changes:        make(chan hubRequest, changeQueueSize),
+		outbound:       make(chan model.ChatMessage, outboundQueueSize),
+		local:          make(chan model.ChatMessage, 64),
+		metricsReq:     make(chan chan []ClientMetrics),
+		requests:       make(chan hubRequest),
+		sanitizer:      bluemonday.StrictPolicy(),
+		filters:        filter.Default(),
+		heartbeat:      DefaultHeartbeat(),
 	}
 }
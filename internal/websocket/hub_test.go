@@ -0,0 +1,312 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+	"github.com/johndosdos/chatter/internal/broker"
+	"github.com/johndosdos/chatter/internal/model"
+)
+
+// connect registers a client to the hub over a real websocket connection. It
+// returns the client and the browser's end of the connection.
+func connect(ctx context.Context, t *testing.T, hub *Hub, username string, channel Channel) (*Client, *websocket.Conn) {
+	t.Helper()
+	return connectWith(ctx, t, hub, username, channel, nil)
+}
+
+// connectWith is connect for a browser offering the subprotocols.
+func connectWith(ctx context.Context, t *testing.T, hub *Hub, username string, channel Channel, offered []string) (*Client, *websocket.Conn) {
+	t.Helper()
+
+	accepted := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{Subprotocols: subprotocols})
+		if err != nil {
+			t.Errorf("Accept() error = %+v", err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	browser, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"),
+		&websocket.DialOptions{Subprotocols: offered})
+	if err != nil {
+		t.Fatalf("Dial() error = %+v", err)
+	}
+	t.Cleanup(func() { browser.CloseNow() }) //nolint:errcheck
+
+	client := NewClient(<-accepted, uuid.New(), username, channel, "/chat")
+	reg := Registration{Client: client, Done: make(chan struct{})}
+	hub.Register <- reg
+	<-reg.Done
+
+	return client, browser
+}
+
+func runHub(t *testing.T) (context.Context, *Hub) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	hub := NewHub(nil, broker.NewMemory())
+	go hub.Run(ctx)
+
+	return ctx, hub
+}
+
+func TestStuckClientDoesNotStallBroadcast(t *testing.T) {
+	ctx, hub := runHub(t)
+	channel := Channel{RoomID: 1}
+
+	healthy, _ := connect(ctx, t, hub, "healthy", channel)
+	// Nothing ever reads the stuck client's queue.
+	_, stuckBrowser := connect(ctx, t, hub, "stuck", channel)
+
+	// Messages are sent in waves the healthy client keeps up with, while the
+	// stuck client falls further behind with every wave.
+	const wave = messageQueueSize / 2
+	received := make(chan struct{})
+	go func() {
+		n := 0
+		for payload := range healthy.MessageCh {
+			if payload.Type != payloadMessage {
+				continue
+			}
+			if n++; n%wave == 0 {
+				received <- struct{}{}
+			}
+		}
+	}()
+
+	for i := range 10 * wave {
+		err := hub.broker.Publish(ctx, model.ChatMessage{
+			ID:      int64(i + 1),
+			RoomID:  channel.RoomID,
+			UserID:  uuid.New(),
+			Content: "hello",
+			Type:    payloadMessage,
+		})
+		if err != nil {
+			t.Fatalf("Publish() error = %+v", err)
+		}
+
+		if (i+1)%wave == 0 {
+			select {
+			case <-received:
+			case <-ctx.Done():
+				t.Fatalf("the healthy client stopped receiving after %d messages", i+1)
+			}
+		}
+	}
+
+	// The stuck client is disconnected and told to reconnect.
+	_, _, err := stuckBrowser.Read(ctx)
+	if status := websocket.CloseStatus(err); status != websocket.StatusTryAgainLater {
+		t.Errorf("want close status %v, got %v", websocket.StatusTryAgainLater, err)
+	}
+
+	metrics, err := hub.Metrics(ctx)
+	if err != nil {
+		t.Fatalf("Metrics() error = %+v", err)
+	}
+	if len(metrics) != 1 || metrics[0].Username != "healthy" {
+		t.Errorf("want only the healthy client connected, got %+v", metrics)
+	}
+}
+
+func TestTypingFloodDropsOldest(t *testing.T) {
+	ctx, hub := runHub(t)
+	channel := Channel{RoomID: 1}
+
+	client, _ := connect(ctx, t, hub, "reader", channel)
+
+	const total = 10 * messageQueueSize
+	for i := range total {
+		err := hub.broker.Publish(ctx, model.ChatMessage{
+			RoomID:   channel.RoomID,
+			UserID:   uuid.New(),
+			Username: strconv.Itoa(i),
+			Type:     payloadTyping,
+		})
+		if err != nil {
+			t.Fatalf("Publish() error = %+v", err)
+		}
+	}
+	// Payloads are dispatched in order, so the typing indicators were all
+	// queued once the message is.
+	err := hub.broker.Publish(ctx, model.ChatMessage{
+		ID:     1,
+		RoomID: channel.RoomID,
+		UserID: uuid.New(),
+		Type:   payloadMessage,
+	})
+	if err != nil {
+		t.Fatalf("Publish() error = %+v", err)
+	}
+
+	select {
+	case payload := <-client.MessageCh:
+		if payload.Type != payloadMessage {
+			t.Errorf("want a message, got %+v", payload)
+		}
+	case <-ctx.Done():
+		t.Fatal("the message was not delivered")
+	}
+
+	metrics, err := hub.Metrics(ctx)
+	if err != nil {
+		t.Fatalf("Metrics() error = %+v", err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("want the client still connected, got %+v", metrics)
+	}
+	if metrics[0].Dropped == 0 || metrics[0].MaxQueued > ephemeralQueueSize+1 {
+		t.Errorf("want typing indicators dropped, got %+v", metrics[0])
+	}
+
+	// The latest typing indicators are kept.
+	var last model.ChatMessage
+	for len(client.ephemeralCh) > 0 {
+		last = <-client.ephemeralCh
+	}
+	if want := strconv.Itoa(total - 1); last.Username != want {
+		t.Errorf("want the last typing indicator from %s, got %+v", want, last)
+	}
+}
+
+// failingBroker delivers nothing it is asked to publish.
+type failingBroker struct {
+	*broker.Memory
+}
+
+func (failingBroker) Publish(context.Context, model.ChatMessage) error {
+	return broker.ErrPayloadTooLarge
+}
+
+func TestRejectWithoutBroker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hub := NewHub(nil, failingBroker{broker.NewMemory()})
+	go hub.Run(ctx)
+
+	channel := Channel{RoomID: 1}
+	client, _ := connect(ctx, t, hub, "sender", channel)
+
+	// The sender is told even though the broker is down.
+	hub.reject(ctx, model.ChatMessage{UserID: client.UserID, RoomID: channel.RoomID}, noticeUndelivered)
+
+	select {
+	case payload := <-client.MessageCh:
+		if payload.Type != payloadRejected || payload.Content != noticeUndelivered {
+			t.Errorf("want the notice, got %+v", payload)
+		}
+	case <-ctx.Done():
+		t.Fatal("the notice was not delivered")
+	}
+}
+
+func TestRequestGivesUpOnBusyHub(t *testing.T) {
+	// The hub never runs, as if it were stuck.
+	hub := NewHub(nil, broker.NewMemory())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := hub.Kick(ctx, uuid.New(), "bye"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestLeave(t *testing.T) {
+	ctx, hub := runHub(t)
+	channel := Channel{RoomID: 1}
+
+	leaving, browser := connect(ctx, t, hub, "leaving", channel)
+	go leaving.WriteMessage(ctx)
+
+	if err := hub.Leave(ctx, leaving.UserID, channel); err != nil {
+		t.Fatalf("Leave() error = %+v", err)
+	}
+
+	// The notice and presence updates come before the connection is closed.
+	for {
+		_, _, err := browser.Read(ctx)
+		if err == nil {
+			continue
+		}
+		if status := websocket.CloseStatus(err); status != websocket.StatusNormalClosure {
+			t.Errorf("want close status %v, got %v", websocket.StatusNormalClosure, err)
+		}
+		break
+	}
+}
+
+func TestChangeQueueFull(t *testing.T) {
+	// The hub never runs, so nothing is taken off the queue.
+	hub := NewHub(nil, broker.NewMemory())
+	for range changeQueueSize {
+		hub.changes <- hubRequest{}
+	}
+
+	req := hubRequest{
+		payload: model.ChatMessage{Type: payloadKick},
+		done:    make(chan error, 1),
+	}
+	hub.queueChange(context.Background(), req)
+
+	if err := <-req.done; !errors.Is(err, ErrBusy) {
+		t.Errorf("want %v, got %v", ErrBusy, err)
+	}
+}
+
+// stalledBroker never finishes publishing.
+type stalledBroker struct {
+	*broker.Memory
+}
+
+func (stalledBroker) Publish(ctx context.Context, _ model.ChatMessage) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStalledBrokerDoesNotStallHub(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hub := NewHub(nil, stalledBroker{broker.NewMemory()})
+	go hub.Run(ctx)
+
+	channel := Channel{RoomID: 1}
+	client, _ := connect(ctx, t, hub, "typist", channel)
+	connect(ctx, t, hub, "reader", channel)
+
+	for range 2 * outboundQueueSize {
+		hub.ClientMsg <- model.ChatMessage{
+			UserID: client.UserID,
+			RoomID: channel.RoomID,
+			Type:   payloadTyping,
+		}
+	}
+
+	metricsCtx, cancelMetrics := context.WithTimeout(ctx, time.Second)
+	defer cancelMetrics()
+	metrics, err := hub.Metrics(metricsCtx)
+	if err != nil {
+		t.Fatalf("Metrics() error = %+v", err)
+	}
+	if len(metrics) != 2 {
+		t.Errorf("want 2 clients connected, got %+v", metrics)
+	}
+}
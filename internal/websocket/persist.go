@@ -0,0 +1,282 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/johndosdos/chatter/internal/database"
+	"github.com/johndosdos/chatter/internal/filter"
+	"github.com/johndosdos/chatter/internal/model"
+)
+
+const (
+	// persistQueueSize bounds the new messages waiting to be stored. Senders
+	// are told to try again once it is full.
+	persistQueueSize = 256
+
+	// persistBatchSize caps the number of messages stored by a single insert.
+	persistBatchSize = 100
+)
+
+// Reasons shown to the sender of a message that was not sent.
+const (
+	noticeBusy   = "The server is busy, try again in a moment."
+	noticeFailed = "It could not be saved, try again."
+	noticeThread = "The thread is no longer available."
+	// noticePinForbidden is shown to users pinning the message of another
+	// user without being a moderator.
+	noticePinForbidden = "Only the author of a message and moderators can pin it."
+	// noticeUndelivered is shown when a change was saved but not sent to the
+	// other users.
+	noticeUndelivered = "It was saved but could not be delivered. Reload the page to see it."
+)
+
+// pendingMessage is a new message on its way to the database.
+type pendingMessage struct {
+	payload model.ChatMessage
+	// flags holds the reasons the content filters flagged the message for.
+	flags []string
+	// stored is set once the message has an ID.
+	stored bool
+}
+
+// runPersist filters, stores and publishes new messages off the hub's main
+// loop, so that a slow database never holds up the other clients. Messages
+// are handled in the order they were queued: whatever queues up while a
+// batch is being stored goes into the next one.
+//
+// It returns once Run closes the queue. The messages still queued by then
+// are stored all the same, so that their senders find them when they
+// reconnect, or are rejected if they cannot be.
+func (h *Hub) runPersist(ctx context.Context) {
+	// Shutting down must not abort a batch halfway; Run bounds how long it
+	// waits for us instead.
+	ctx = context.WithoutCancel(ctx)
+
+	for {
+		payload, ok := <-h.persist
+		if !ok {
+			return
+		}
+		batch := []model.ChatMessage{payload}
+
+	fill:
+		for len(batch) < persistBatchSize {
+			select {
+			case payload, ok := <-h.persist:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, payload)
+			default:
+				break fill
+			}
+		}
+
+		h.storeMessages(ctx, batch)
+	}
+}
+
+// queueMessage hands a new message over to runPersist. The sender is told
+// to try again when the queue is full.
+func (h *Hub) queueMessage(ctx context.Context, payload model.ChatMessage) {
+	select {
+	case h.persist <- payload:
+	default:
+		log.Printf("message queue full, rejecting message of user %s", payload.UserID)
+		h.rejectLocal(ctx, payload, noticeBusy)
+	}
+}
+
+// rejection returns the notice telling the sender of the payload that it
+// was not sent, and why.
+func rejection(payload model.ChatMessage, reason string) model.ChatMessage {
+	return model.ChatMessage{
+		RoomID:         payload.RoomID,
+		ConversationID: payload.ConversationID,
+		UserID:         payload.UserID,
+		Content:        reason,
+		Type:           payloadRejected,
+	}
+}
+
+// reject tells the sender of the payload that it was not sent, and why. The
+// sender is connected to this instance, so the notice is delivered locally
+// when the broker fails.
+func (h *Hub) reject(ctx context.Context, payload model.ChatMessage, reason string) {
+	rejected := rejection(payload, reason)
+	if err := h.publish(ctx, rejected); err == nil {
+		return
+	}
+
+	rejected.Origin = h.instanceID
+	select {
+	case h.local <- rejected:
+	default:
+		log.Printf("local queue full, dropping notice for user %s", payload.UserID)
+	}
+}
+
+// rejectLocal is reject for the main loop, which must not wait on the
+// broker. The notice only reaches the sender's connections to this
+// instance.
+func (h *Hub) rejectLocal(ctx context.Context, payload model.ChatMessage, reason string) {
+	rejected := rejection(payload, reason)
+	rejected.Origin = h.instanceID
+	h.dispatch(ctx, rejected)
+}
+
+// filterContent applies the content filters to a message or edit. It
+// reports false, after telling the sender, if the payload must not be sent.
+func (h *Hub) filterContent(ctx context.Context, payload model.ChatMessage) (model.ChatMessage, []string, bool) {
+	result, err := h.filters.Apply(ctx, filter.Message{
+		UserID:  payload.UserID,
+		Content: payload.Content,
+	})
+	if err != nil {
+		log.Printf("failed to filter message: %v", err)
+		h.reject(ctx, payload, noticeFailed)
+		return payload, nil, false
+	}
+	if result.Reject != "" {
+		h.reject(ctx, payload, result.Reject)
+		return payload, nil, false
+	}
+	payload.Content = result.Content
+
+	return payload, result.Flags, true
+}
+
+// storeMessages filters and stores a batch of new messages, then publishes
+// the ones that were stored, in order.
+func (h *Hub) storeMessages(ctx context.Context, batch []model.ChatMessage) {
+	pending := make([]pendingMessage, 0, len(batch))
+	for _, payload := range batch {
+		payload, flags, ok := h.filterContent(ctx, payload)
+		if !ok {
+			continue
+		}
+		if payload.ParentID != 0 {
+			if err := h.checkThread(ctx, payload); err != nil {
+				log.Printf("failed to reply to message %d: %v", payload.ParentID, err)
+				h.reject(ctx, payload, noticeThread)
+				continue
+			}
+		}
+		pending = append(pending, pendingMessage{payload: payload, flags: flags})
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	if err := h.insertMessages(ctx, pending); err != nil {
+		// A single bad message fails the whole batch. Store the messages one
+		// by one, so that only the senders of the failing ones try again.
+		log.Printf("failed to store a batch of %d messages: %v", len(pending), err)
+		h.insertEach(ctx, pending)
+	}
+
+	for _, msg := range pending {
+		if !msg.stored {
+			continue
+		}
+		payload := msg.payload
+
+		mentions, err := h.storeMentions(ctx, payload)
+		if err != nil {
+			log.Printf("failed to store mentions of message %d: %v", payload.ID, err)
+		}
+		payload.Mentions = mentions
+
+		if payload.ParentID != 0 {
+			// Replies carry the updated summary of their thread.
+			thread, err := h.threadSummary(ctx, payload.ParentID)
+			if err != nil {
+				log.Printf("failed to summarize thread %d: %v", payload.ParentID, err)
+			}
+			payload.Thread = thread
+		}
+
+		if len(msg.flags) > 0 {
+			if err := h.flagMessage(ctx, payload.ID, msg.flags); err != nil {
+				log.Printf("failed to flag message %d: %v", payload.ID, err)
+			}
+		}
+
+		if err := h.publish(ctx, payload); err != nil {
+			h.reject(ctx, payload, noticeUndelivered)
+		}
+	}
+}
+
+// insertMessages stores the messages with a single insert.
+func (h *Hub) insertMessages(ctx context.Context, pending []pendingMessage) error {
+	params := database.CreateMessagesParams{
+		Users:         make([]pgtype.UUID, 0, len(pending)),
+		Rooms:         make([]int64, 0, len(pending)),
+		Conversations: make([]int64, 0, len(pending)),
+		Parents:       make([]int64, 0, len(pending)),
+		Contents:      make([]string, 0, len(pending)),
+		Created:       make([]pgtype.Timestamptz, 0, len(pending)),
+	}
+	for _, msg := range pending {
+		payload := msg.payload
+		params.Users = append(params.Users, pgtype.UUID{Bytes: payload.UserID, Valid: true})
+		params.Rooms = append(params.Rooms, payload.RoomID)
+		params.Conversations = append(params.Conversations, payload.ConversationID)
+		params.Parents = append(params.Parents, payload.ParentID)
+		params.Contents = append(params.Contents, payload.Content)
+		params.Created = append(params.Created, pgtype.Timestamptz{Time: payload.CreatedAt, Valid: true})
+	}
+
+	rows, err := h.db.CreateMessages(ctx, params)
+	if err != nil {
+		return err
+	}
+	if len(rows) != len(pending) {
+		return errors.New("not every message was stored")
+	}
+
+	// Rows are not returned in any particular order. Each one carries the
+	// position of its message in the batch, starting at 1.
+	for _, row := range rows {
+		if row.Position < 1 || row.Position > int64(len(pending)) {
+			// The messages were stored all the same; retrying them would
+			// store them twice.
+			log.Printf("message %d stored at unknown position %d", row.ID, row.Position)
+			continue
+		}
+		msg := &pending[row.Position-1]
+		msg.payload.ID = row.ID
+		msg.payload.CreatedAt = row.CreatedAt.Time
+		msg.stored = true
+	}
+
+	return nil
+}
+
+// insertEach stores the messages one at a time. The senders of the messages
+// that fail are told to try again.
+func (h *Hub) insertEach(ctx context.Context, pending []pendingMessage) {
+	for i, msg := range pending {
+		payload := msg.payload
+		created, err := h.db.CreateMessage(ctx, database.CreateMessageParams{
+			UserID:         pgtype.UUID{Bytes: payload.UserID, Valid: true},
+			RoomID:         pgtype.Int8{Int64: payload.RoomID, Valid: payload.RoomID != 0},
+			ConversationID: pgtype.Int8{Int64: payload.ConversationID, Valid: payload.ConversationID != 0},
+			ParentID:       pgtype.Int8{Int64: payload.ParentID, Valid: payload.ParentID != 0},
+			Content:        payload.Content,
+			CreatedAt:      pgtype.Timestamptz{Time: payload.CreatedAt, Valid: true},
+		})
+		if err != nil {
+			log.Printf("failed to store message of user %s: %v", payload.UserID, err)
+			h.reject(ctx, payload, noticeFailed)
+			continue
+		}
+		pending[i].payload.ID = created.ID
+		pending[i].payload.CreatedAt = created.CreatedAt.Time
+		pending[i].stored = true
+	}
+}
@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/johndosdos/chatter/internal/broker"
+	"github.com/johndosdos/chatter/internal/database"
+	"github.com/johndosdos/chatter/internal/model"
+	"github.com/johndosdos/chatter/internal/testutil"
+	"github.com/joho/godotenv"
+)
+
+func TestStoreMessagesBatch(t *testing.T) {
+	if err := godotenv.Load(filepath.Join(testutil.ProjectRoot(), ".env")); err != nil {
+		t.Logf("failed to load .env file: %+v", err)
+	}
+	if os.Getenv("TEST_DB_URL") == "" {
+		t.Skip("TEST_DB_URL environment variable is not set")
+	}
+
+	db, dbForGoose, migDir := testutil.DbInit()
+	testutil.DbGooseUp(dbForGoose, migDir)
+	defer testutil.DbCleanup(db, migDir)
+
+	queries := database.New(db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID := uuid.New()
+	if _, err := queries.CreateUser(ctx, database.CreateUserParams{
+		UserID:   pgtype.UUID{Bytes: userID, Valid: true},
+		Username: "sender",
+		Email:    "sender@test.com",
+	}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	var channels []Channel
+	for _, name := range []string{"alpha", "beta"} {
+		room, err := queries.CreateRoom(ctx, database.CreateRoomParams{
+			Name:      name,
+			CreatedBy: pgtype.UUID{Bytes: userID, Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		channels = append(channels, Channel{RoomID: room.ID})
+	}
+
+	hub := NewHub(queries, broker.NewMemory())
+	go hub.Run(ctx)
+
+	readers := make(map[Channel]*Client)
+	for _, channel := range channels {
+		readers[channel], _ = connect(ctx, t, hub, "reader", channel)
+	}
+
+	// The messages alternate between the channels, and are older than the
+	// ones before them, so that neither the channel nor the creation time
+	// gives their order away.
+	const total = 6
+	start := time.Now().UTC().Truncate(time.Microsecond)
+	var batch []model.ChatMessage
+	for i := range total {
+		channel := channels[i%len(channels)]
+		batch = append(batch, model.ChatMessage{
+			RoomID:    channel.RoomID,
+			UserID:    userID,
+			Username:  "sender",
+			Content:   "message " + strconv.Itoa(i),
+			CreatedAt: start.Add(-time.Duration(i) * time.Minute),
+			Type:      payloadMessage,
+		})
+	}
+	hub.storeMessages(ctx, batch)
+
+	for i, want := range batch {
+		channel := Channel{RoomID: want.RoomID}
+
+		var got model.ChatMessage
+		for got.Type != payloadMessage {
+			select {
+			case got = <-readers[channel].MessageCh:
+			case <-ctx.Done():
+				t.Fatalf("message %d was not delivered", i)
+			}
+		}
+		if got.Content != want.Content {
+			t.Fatalf("want %q in room %d, got %q", want.Content, channel.RoomID, got.Content)
+		}
+
+		stored, err := queries.GetMessage(ctx, got.ID)
+		if err != nil {
+			t.Fatalf("GetMessage(%d) error = %+v", got.ID, err)
+		}
+		if stored.Content != want.Content || stored.RoomID.Int64 != want.RoomID {
+			t.Errorf("message %d holds %q in room %d, want %q in room %d",
+				got.ID, stored.Content, stored.RoomID.Int64, want.Content, want.RoomID)
+		}
+		if !got.CreatedAt.Equal(stored.CreatedAt.Time) || !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("message %d delivered at %v, stored at %v, want %v",
+				got.ID, got.CreatedAt, stored.CreatedAt.Time, want.CreatedAt)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+	"github.com/johndosdos/chatter/internal/model"
+)
+
+// Event types of the JSON protocol.
+const (
+	EventMessage     = "message"
+	EventEdit        = "edit"
+	EventDelete      = "delete"
+	EventTyping      = "typing"
+	EventPresence    = "presence"
+	EventRateLimit   = "rate_limit"
+	EventRead        = "read"
+	EventReceipts    = "receipts"
+	EventReactions   = "reactions"
+	EventMention     = "mention"
+	EventPins        = "pins"
+	EventMute        = "mute"
+	EventMuteWarning = "mute_warning"
+	EventRejected    = "rejected"
+	EventKick        = "kick"
+	EventLeave       = "leave"
+)
+
+// Event is a server event of the JSON protocol. Data holds one of the
+// *Event types below, depending on Type.
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// MessageEvent is a new message, reply, edit, deletion or mention.
+type MessageEvent struct {
+	ID             int64           `json:"id"`
+	RoomID         int64           `json:"room_id,omitempty"`
+	ConversationID int64           `json:"conversation_id,omitempty"`
+	ParentID       int64           `json:"parent_id,omitempty"`
+	UserID         uuid.UUID       `json:"user_id"`
+	Username       string          `json:"username"`
+	Content        string          `json:"content"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Edited         bool            `json:"edited,omitempty"`
+	Deleted        bool            `json:"deleted,omitempty"`
+	Mentions       []model.Mention `json:"mentions,omitempty"`
+	// Thread summarizes the thread of a reply, after the reply.
+	Thread model.Thread `json:"thread,omitzero"`
+}
+
+// TypingEvent tells that another user is typing.
+type TypingEvent struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+}
+
+// PresenceEvent counts the users connected to the channel.
+type PresenceEvent struct {
+	Count int `json:"count"`
+}
+
+// RateLimitEvent tells the user to slow down. Messages sent before
+// RetryAfter seconds are dropped.
+type RateLimitEvent struct {
+	RetryAfter int `json:"retry_after"`
+}
+
+// ReadEvent moves the user's read marker.
+type ReadEvent struct {
+	LastReadID int64 `json:"last_read_id"`
+	Unread     int   `json:"unread"`
+}
+
+// ReceiptsEvent updates the receipts of the user's own messages.
+type ReceiptsEvent struct {
+	Receipts []model.Receipt `json:"receipts"`
+}
+
+// ReactionsEvent holds every reaction to a message.
+type ReactionsEvent struct {
+	MessageID int64            `json:"message_id"`
+	Reactions []model.Reaction `json:"reactions"`
+}
+
+// PinsEvent holds every message pinned to the channel, latest first.
+type PinsEvent struct {
+	Pins []model.Pin `json:"pins"`
+}
+
+// MuteEvent tells the user they are muted until the given time. The zero
+// time lifts the mute.
+type MuteEvent struct {
+	Until  time.Time `json:"until,omitzero"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// NoticeEvent explains why a message was rejected, the user kicked or
+// disconnected from a channel they left.
+type NoticeEvent struct {
+	Reason string `json:"reason"`
+}
+
+// Command is a client command of the JSON protocol. Type is one of message,
+// typing, edit, delete, react, pin, unpin, read and ack; the other fields
+// depend on it.
+type Command struct {
+	Type string `json:"type"`
+	// ID is the message to edit, delete, react to, pin or unpin, or the last
+	// message read.
+	ID int64 `json:"id,omitempty"`
+	// ParentID is the message starting the thread a new message replies to.
+	ParentID int64  `json:"parent_id,omitempty"`
+	Content  string `json:"content,omitempty"`
+	Emoji    string `json:"emoji,omitempty"`
+	// IDs holds the messages received, for ack.
+	IDs []int64 `json:"ids,omitempty"`
+}
+
+// commands maps the command types to payload types.
+var commands = map[string]string{
+	"message": payloadMessage,
+	"typing":  payloadMessage,
+	"edit":    payloadEdit,
+	"delete":  payloadDelete,
+	"react":   payloadReact,
+	"pin":     payloadPin,
+	"unpin":   payloadUnpin,
+	"read":    payloadRead,
+	"ack":     payloadAck,
+}
+
+// decode reads a payload sent by the client. It reports whether the payload
+// is a typing indicator, which both protocols send as a message: the JSON
+// protocol as a typing command, the HTMX page through the element that
+// triggered the request.
+func (c *Client) decode(p []byte) (model.ChatMessage, bool, error) {
+	if c.protocol != SubprotocolJSON {
+		var payload model.ChatMessage
+		if err := json.Unmarshal(p, &payload); err != nil {
+			return payload, false, err
+		}
+		return payload, payload.Headers["HX-Trigger"] == "user-input", nil
+	}
+
+	var cmd Command
+	if err := json.Unmarshal(p, &cmd); err != nil {
+		return model.ChatMessage{}, false, err
+	}
+	payloadType, ok := commands[cmd.Type]
+	if !ok {
+		return model.ChatMessage{}, false, fmt.Errorf("unknown command %q", cmd.Type)
+	}
+
+	payload := model.ChatMessage{
+		ID:       cmd.ID,
+		ParentID: cmd.ParentID,
+		Content:  cmd.Content,
+		IDs:      cmd.IDs,
+		Type:     payloadType,
+	}
+	if payloadType == payloadReact {
+		payload.Content = cmd.Emoji
+	}
+
+	return payload, cmd.Type == "typing", nil
+}
+
+// event returns the event of the JSON protocol for the payload, or false
+// when the client should not receive it. It keeps the same state as the
+// HTML rendering in WriteMessage.
+func (c *Client) event(payload model.ChatMessage) (Event, bool) {
+	fromSender := payload.UserID == c.UserID
+
+	switch payload.Type {
+	case payloadMessage:
+		return Event{Type: EventMessage, Data: messageEvent(payload)}, true
+
+	case payloadEdit, payloadDelete:
+		eventType := EventEdit
+		if payload.Type == payloadDelete {
+			eventType = EventDelete
+		}
+		return Event{Type: eventType, Data: messageEvent(payload)}, true
+
+	case payloadMention:
+		return Event{Type: EventMention, Data: messageEvent(payload)}, true
+
+	case payloadTyping:
+		if fromSender {
+			return Event{}, false
+		}
+		return Event{Type: EventTyping, Data: TypingEvent{
+			UserID:   payload.UserID,
+			Username: payload.Username,
+		}}, true
+
+	case payloadPresenceCount:
+		count, err := strconv.Atoi(payload.Content)
+		if err != nil {
+			slog.Error("failed to convert string to int", slog.Any("error", err))
+			return Event{}, false
+		}
+		return Event{Type: EventPresence, Data: PresenceEvent{Count: count}}, true
+
+	case payloadRateLimit:
+		limitWindow := 10 * time.Second // 10s penalty when burst sending 30 messages/min
+		timeRemaining := limitWindow - time.Since(c.timeWarned)
+		return Event{Type: EventRateLimit, Data: RateLimitEvent{
+			RetryAfter: int(timeRemaining.Seconds()),
+		}}, true
+
+	case payloadRead:
+		if !fromSender {
+			return Event{}, false
+		}
+		unread, err := strconv.Atoi(payload.Content)
+		if err != nil {
+			slog.Error("failed to convert string to int", slog.Any("error", err))
+			return Event{}, false
+		}
+		c.lastRead = payload.ID
+		c.unread = unread
+		return Event{Type: EventRead, Data: ReadEvent{LastReadID: c.lastRead, Unread: c.unread}}, true
+
+	case payloadReceipt:
+		// Only the authors get the receipts of their messages.
+		var receipts []model.Receipt
+		for _, receipt := range payload.Receipts {
+			if receipt.SenderID == c.UserID {
+				receipts = append(receipts, receipt)
+			}
+		}
+		if len(receipts) == 0 {
+			return Event{}, false
+		}
+		return Event{Type: EventReceipts, Data: ReceiptsEvent{Receipts: receipts}}, true
+
+	case payloadReact:
+		return Event{Type: EventReactions, Data: ReactionsEvent{
+			MessageID: payload.ID,
+			Reactions: payload.Reactions,
+		}}, true
+
+	case payloadPins:
+		return Event{Type: EventPins, Data: PinsEvent{Pins: payload.Pins}}, true
+
+	case payloadMute:
+		c.SetMute(payload.Until)
+		return Event{Type: EventMute, Data: MuteEvent{Until: payload.Until, Reason: payload.Content}}, true
+
+	case payloadMuteWarning:
+		return Event{Type: EventMuteWarning, Data: MuteEvent{Until: c.mutedUntil()}}, true
+
+	case payloadRejected:
+		if !fromSender {
+			return Event{}, false
+		}
+		return Event{Type: EventRejected, Data: NoticeEvent{Reason: payload.Content}}, true
+
+	case payloadKick:
+		return Event{Type: EventKick, Data: NoticeEvent{Reason: payload.Content}}, true
+
+	case payloadLeave:
+		return Event{Type: EventLeave, Data: NoticeEvent{Reason: payload.Content}}, true
+	}
+
+	return Event{}, false
+}
+
+func messageEvent(payload model.ChatMessage) MessageEvent {
+	return MessageEvent{
+		ID:             payload.ID,
+		RoomID:         payload.RoomID,
+		ConversationID: payload.ConversationID,
+		ParentID:       payload.ParentID,
+		UserID:         payload.UserID,
+		Username:       payload.Username,
+		Content:        payload.Content,
+		CreatedAt:      payload.CreatedAt,
+		Edited:         payload.Edited,
+		Deleted:        payload.Deleted,
+		Mentions:       payload.Mentions,
+		Thread:         payload.Thread,
+	}
+}
+
+// writeEvent writes an event of the JSON protocol.
+func (c *Client) writeEvent(ctx context.Context, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to encode event",
+			"error", err,
+			"event_type", event.Type)
+		return
+	}
+
+	writeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := c.conn.Write(writeCtx, websocket.MessageText, data); err != nil {
+		slog.WarnContext(ctx, "failed to write event",
+			"error", err,
+			"event_type", event.Type)
+	}
+}
@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+	"github.com/johndosdos/chatter/internal/model"
+)
+
+// connectJSON connects a client speaking the JSON protocol and starts it.
+func connectJSON(ctx context.Context, t *testing.T, hub *Hub, username string, channel Channel) *websocket.Conn {
+	t.Helper()
+
+	client, conn := connectWith(ctx, t, hub, username, channel, []string{SubprotocolJSON})
+	if client.protocol != SubprotocolJSON {
+		t.Fatalf("want subprotocol %q, got %q", SubprotocolJSON, client.protocol)
+	}
+	client.SetMessageLimiter(30, time.Minute)
+	client.SetTypingLimiter(30, time.Minute)
+	go client.ReadMessage(ctx)
+	go client.WriteMessage(ctx)
+
+	return conn
+}
+
+// readEvent reads events until one of the given type, and decodes its data.
+func readEvent(ctx context.Context, t *testing.T, conn *websocket.Conn, eventType string, data any) {
+	t.Helper()
+
+	for {
+		_, p, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read() error = %+v, want a %s event", err, eventType)
+		}
+
+		var event struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(p, &event); err != nil {
+			t.Fatalf("want a JSON event, got %s: %v", p, err)
+		}
+		if event.Type != eventType {
+			continue
+		}
+		if err := json.Unmarshal(event.Data, data); err != nil {
+			t.Fatalf("failed to decode the data of %s: %v", p, err)
+		}
+		return
+	}
+}
+
+func TestJSONProtocol(t *testing.T) {
+	ctx, hub := runHub(t)
+	channel := Channel{RoomID: 1}
+
+	alice := connectJSON(ctx, t, hub, "alice", channel)
+	bob := connectJSON(ctx, t, hub, "bob", channel)
+
+	var presence PresenceEvent
+	readEvent(ctx, t, bob, EventPresence, &presence)
+	if presence.Count != 2 {
+		t.Errorf("want 2 users present, got %d", presence.Count)
+	}
+
+	// Typing is a command of its own.
+	if err := alice.Write(ctx, websocket.MessageText, []byte(`{"type": "typing"}`)); err != nil {
+		t.Fatalf("Write() error = %+v", err)
+	}
+	var typing TypingEvent
+	readEvent(ctx, t, bob, EventTyping, &typing)
+	if typing.Username != "alice" {
+		t.Errorf("want alice typing, got %+v", typing)
+	}
+
+	want := model.ChatMessage{
+		ID:        1,
+		RoomID:    channel.RoomID,
+		UserID:    uuid.New(),
+		Username:  "carol",
+		Content:   "hello",
+		CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Type:      payloadMessage,
+	}
+	if err := hub.broker.Publish(ctx, want); err != nil {
+		t.Fatalf("Publish() error = %+v", err)
+	}
+	var got MessageEvent
+	readEvent(ctx, t, bob, EventMessage, &got)
+	if got.ID != want.ID || got.Username != want.Username || got.Content != want.Content ||
+		got.UserID != want.UserID || !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("want message %+v, got %+v", want, got)
+	}
+}
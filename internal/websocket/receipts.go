@@ -0,0 +1,155 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/johndosdos/chatter/internal/database"
+	"github.com/johndosdos/chatter/internal/model"
+)
+
+const (
+	// receiptFlushInterval is how long receipt updates are batched before
+	// being stored and published.
+	receiptFlushInterval = time.Second
+
+	// receiptBatchSize flushes the batch early once it holds that many
+	// updates.
+	receiptBatchSize = 256
+
+	// receiptsPerPayload keeps receipt payloads under the broker's payload
+	// size limit.
+	receiptsPerPayload = 50
+)
+
+// receiptUpdate records that a user received or read messages of their
+// channel.
+type receiptUpdate struct {
+	userID  uuid.UUID
+	channel Channel
+	// delivered holds the IDs of the messages rendered by the user's browser.
+	delivered []int64
+	// readAfter and readUpTo bound the IDs of the messages the user read.
+	readAfter int64
+	readUpTo  int64
+}
+
+// runReceipts batches receipt updates off the hub's main loop. Acks arrive
+// in bursts, with every connected browser acknowledging every message.
+func (h *Hub) runReceipts(ctx context.Context) {
+	ticker := time.NewTicker(receiptFlushInterval)
+	defer ticker.Stop()
+
+	var batch []receiptUpdate
+	for {
+		select {
+		case update := <-h.receipts:
+			batch = append(batch, update)
+			if len(batch) >= receiptBatchSize {
+				h.flushReceipts(ctx, batch)
+				batch = nil
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				h.flushReceipts(ctx, batch)
+				batch = nil
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// queueReceipt hands an update over to runReceipts. Receipts are best
+// effort: the update is dropped when the queue is full.
+func (h *Hub) queueReceipt(update receiptUpdate) {
+	select {
+	case h.receipts <- update:
+	default:
+		log.Printf("receipt queue full, dropping update of user %s", update.userID)
+	}
+}
+
+// flushReceipts stores a batch of updates, then publishes the receipts of
+// the messages they changed.
+func (h *Hub) flushReceipts(ctx context.Context, batch []receiptUpdate) {
+	var changed []int64
+	for _, update := range batch {
+		userID := pgtype.UUID{Bytes: update.userID, Valid: true}
+		roomID := pgtype.Int8{Int64: update.channel.RoomID, Valid: update.channel.RoomID != 0}
+		conversationID := pgtype.Int8{Int64: update.channel.ConversationID, Valid: update.channel.ConversationID != 0}
+
+		if len(update.delivered) > 0 {
+			ids, err := h.db.MarkDelivered(ctx, database.MarkDeliveredParams{
+				UserID:         userID,
+				Messages:       update.delivered,
+				RoomID:         roomID,
+				ConversationID: conversationID,
+			})
+			if err != nil {
+				log.Printf("failed to mark messages as delivered: %v", err)
+			}
+			changed = append(changed, ids...)
+		}
+
+		// MarkSeen walks the read range a batch at a time, returning the
+		// last message of each batch until the range is used up.
+		for after := update.readAfter; after < update.readUpTo; {
+			row, err := h.db.MarkSeen(ctx, database.MarkSeenParams{
+				UserID:         userID,
+				RoomID:         roomID,
+				ConversationID: conversationID,
+				ReadAfter:      after,
+				ReadUpTo:       update.readUpTo,
+			})
+			if err != nil {
+				log.Printf("failed to mark messages as seen: %v", err)
+				break
+			}
+			changed = append(changed, row.Messages...)
+			if row.LastID == 0 {
+				break
+			}
+			after = row.LastID
+		}
+	}
+
+	if len(changed) == 0 {
+		return
+	}
+
+	rows, err := h.db.ListReceipts(ctx, changed)
+	if err != nil {
+		log.Printf("failed to list receipts: %v", err)
+		return
+	}
+
+	receipts := make(map[Channel][]model.Receipt)
+	for _, row := range rows {
+		channel := Channel{RoomID: row.RoomID.Int64, ConversationID: row.ConversationID.Int64}
+		receipts[channel] = append(receipts[channel], model.Receipt{
+			MessageID: row.ID,
+			SenderID:  row.UserID.Bytes,
+			Delivered: int(row.Delivered),
+			Seen:      int(row.Seen),
+		})
+	}
+
+	for channel, list := range receipts {
+		for len(list) > 0 {
+			n := min(len(list), receiptsPerPayload)
+			h.publish(ctx, model.ChatMessage{
+				RoomID:         channel.RoomID,
+				ConversationID: channel.ConversationID,
+				Receipts:       list[:n],
+				Type:           payloadReceipt,
+			})
+			list = list[n:]
+		}
+	}
+}
@@ -2,7 +2,6 @@ package websocket
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"log/slog"
 	"time"
@@ -16,8 +15,35 @@ const (
 	payloadPresenceCount = "presenceCount"
 	payloadTyping        = "typing"
 	payloadRateLimit     = "rateLimitMessage"
+	payloadEdit          = "edit"
+	payloadDelete        = "delete"
+	payloadReact         = "react"
+	payloadMention       = "mention"
+	payloadRead          = "read"
+	payloadAck           = "ack"
+	payloadReceipt       = "receipt"
+	payloadPin           = "pin"
+	payloadUnpin         = "unpin"
+	payloadPins          = "pins"
+	payloadKick          = "kick"
+	payloadLeave         = "leave"
+	payloadMute          = "mute"
+	payloadMuteWarning   = "muteWarning"
+	payloadRejected      = "rejected"
+
+	// Broker-only payloads exchanged between chatter instances. They are never
+	// written to a client.
+	payloadUserJoined   = "userJoined"
+	payloadUserLeft     = "userLeft"
+	payloadPresenceSync = "presenceSync"
 )
 
+// maxAcks caps the number of messages acknowledged by a single ack.
+const maxAcks = 100
+
+// muteWarnWindow is how often a muted user is reminded of their mute.
+const muteWarnWindow = 10 * time.Second
+
 // ReadMessage reads the incoming data from the websocket stream.
 func (c *Client) ReadMessage(ctx context.Context) {
 	defer func() {
@@ -38,6 +64,7 @@ func (c *Client) ReadMessage(ctx context.Context) {
 			}
 			return
 		}
+		c.touch()
 
 		log.Printf("received message type %v payload: %s", msgType, string(p))
 
@@ -46,27 +73,93 @@ func (c *Client) ReadMessage(ctx context.Context) {
 			continue
 		}
 
-		// We need to unmarshal the JSON sent from the client side. HTMX's ws-send
-		// attribute also sends a HEADERS field along with the client message.
+		// We need to unmarshal the JSON sent from the client side, either as
+		// sent by HTMX's ws-send attribute or as a command of the JSON
+		// protocol.
 		//
 		// Also, set CreatedAt to the current time.
-		// Set message.Type to 'message' as default. Override as needed.
-		var payload model.ChatMessage
-		err = json.Unmarshal(p, &payload)
+		// Set message.Type to 'message' as default, unless the client edits or
+		// deletes a message. Override as needed.
+		payload, typing, err := c.decode(p)
 		if err != nil {
 			log.Printf("failed to process payload from client: %v", err)
 			continue
 		}
+
+		// Payloads without content have their own size limits, below the
+		// connection's.
+		if limit, ok := c.readLimits.Types[payload.Type]; ok && int64(len(p)) > limit {
+			slog.WarnContext(ctx, "payload too big",
+				"payload_type", payload.Type,
+				"size", len(p),
+				"username", c.Username)
+			if err := c.conn.Close(websocket.StatusMessageTooBig, "payload too big"); err != nil {
+				slog.Warn("websocket connection closed", slog.Any("error", err),
+					slog.String("reason", websocket.StatusMessageTooBig.String()))
+			}
+			return
+		}
+
 		// Reassign user info after deserializing the payload. The payload could be hijacked during
 		// transmission and we don't want to assign the incorrect info.
 		payload.UserID = c.UserID
 		payload.Username = c.Username
+		payload.RoomID = c.RoomID
+		payload.ConversationID = c.ConversationID
 		payload.CreatedAt = time.Now().UTC()
-		payload.Type = payloadMessage
+		payload.Edited = false
+		payload.Deleted = false
+		payload.Reactions = nil
+		payload.Mentions = nil
+		payload.Thread = model.Thread{}
+		payload.Receipt = model.Receipt{}
+		payload.Receipts = nil
+		payload.Pins = nil
+		payload.Until = time.Time{}
+
+		// Muted users can still read, but nothing they send reaches the hub.
+		if c.Muted() && payload.Type != payloadAck && payload.Type != payloadRead {
+			if !typing && (c.timeMuteWarned.IsZero() || time.Since(c.timeMuteWarned) > muteWarnWindow) {
+				c.timeMuteWarned = time.Now()
+				c.sendEphemeral(model.ChatMessage{Type: payloadMuteWarning})
+			}
+			continue
+		}
+
+		switch payload.Type {
+		case payloadAck:
+			// Acks skip the hub's main loop and the rate limits; they are
+			// batched by the hub instead.
+			ids := payload.IDs
+			if len(ids) > maxAcks {
+				ids = ids[:maxAcks]
+			}
+			c.Hub.queueReceipt(receiptUpdate{
+				userID:    c.UserID,
+				channel:   c.Channel,
+				delivered: ids,
+			})
+			continue
+		case payloadRead:
+			// payload.ID holds the last message scrolled into view.
+			if payload.ID <= 0 {
+				continue
+			}
+			payload.ParentID = 0
+		case payloadEdit, payloadDelete, payloadReact, payloadPin, payloadUnpin:
+			// payload.ID holds the message to edit, delete, react to or pin. The
+			// hub checks that the user may do so.
+			payload.ParentID = 0
+		default:
+			// payload.ParentID is set for replies to a thread.
+			payload.Type = payloadMessage
+			payload.ID = 0
+		}
+		payload.IDs = nil
 
 		// Check if the message is a typing indicator.
 		// Typing rate limit
-		if trigger, ok := payload.Headers["HX-Trigger"]; ok && trigger == "user-input" {
+		if typing && payload.Type == payloadMessage {
 			payload.Type = payloadTyping
 
 			if !c.typingLim.Allow() {
@@ -74,8 +167,14 @@ func (c *Client) ReadMessage(ctx context.Context) {
 			}
 		}
 
-		// Message rate limit
-		if payload.Type == payloadMessage {
+		// Read markers share the typing rate limit. Dropping one is harmless;
+		// the next one moves the marker further.
+		if payload.Type == payloadRead && !c.typingLim.Allow() {
+			continue
+		}
+
+		// Message rate limit. Edits, deletions and reactions count as messages.
+		if payload.Type != payloadTyping && payload.Type != payloadRead {
 			limitWindow := 10 * time.Second // 10s penalty when burst sending 30 messages/min
 			if !c.timeWarned.IsZero() && time.Since(c.timeWarned) < limitWindow {
 				continue
@@ -83,7 +182,7 @@ func (c *Client) ReadMessage(ctx context.Context) {
 
 			if !c.messageLim.Allow() {
 				c.timeWarned = time.Now()
-				c.MessageCh <- model.ChatMessage{Type: payloadRateLimit}
+				c.sendEphemeral(model.ChatMessage{Type: payloadRateLimit})
 				continue
 			}
 		}
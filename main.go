@@ -8,18 +8,26 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/joho/godotenv"
 	"github.com/pressly/goose/v3"
 
 	"github.com/johndosdos/chatter/internal"
+	"github.com/johndosdos/chatter/internal/audit"
+	"github.com/johndosdos/chatter/internal/auth"
+	"github.com/johndosdos/chatter/internal/broker"
 	"github.com/johndosdos/chatter/internal/database"
+	"github.com/johndosdos/chatter/internal/filter"
 	"github.com/johndosdos/chatter/internal/handler"
 	ratelimiter "github.com/johndosdos/chatter/internal/rate_limiter"
 	ws "github.com/johndosdos/chatter/internal/websocket"
@@ -47,41 +55,6 @@ func main() {
 		port = "8080"
 	}
 
-	/* 	// Init NATS
-	   	var natsCredentials []nats.Option
-
-	   	natsURL := os.Getenv("NATS_URL")
-	   	if natsURL == "" {
-	   		log.Fatal("NATS_URL environment variable is not set")
-	   	}
-
-	   	if cred := os.Getenv("NATS_CRED"); cred != "" {
-	   		natsCredentials = append(natsCredentials, nats.UserCredentials(cred))
-	   	} else if user, pass := os.Getenv("NATS_USER"), os.Getenv("NATS_PASSWORD"); user != "" && pass != "" {
-	   		natsCredentials = append(natsCredentials, nats.UserInfo(user, pass))
-	   	}
-
-	   	natsCredentials = append(natsCredentials, nats.Timeout(5*time.Second))
-
-	   	conn, err := nats.Connect(natsURL, natsCredentials...)
-	   	if err != nil {
-	   		log.Fatalf("failed to connect to nats: %v", err)
-	   	}
-
-	   	js, err := jetstream.New(conn)
-	   	if err != nil {
-	   		log.Fatalf("failed to create jetstream instance: %v", err)
-	   	}
-
-	   	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
-	   		Name:     broker.StreamName,
-	   		Subjects: []string{broker.SubjectGlobalRoom},
-	   		MaxBytes: 1 << 30, // 1GB max storage
-	   	})
-	   	if err != nil {
-	   		log.Fatalf("failed to create/update stream: %v", err)
-	   	} */
-
 	// Init DB
 	dbURL := os.Getenv("DB_URL")
 	if dbURL == "" {
@@ -104,9 +77,64 @@ func main() {
 		log.Fatalf("unable to do up migration: %v", err)
 	}
 
+	// Init broker. Multi-instance deployments need a shared broker so every
+	// replica receives every event.
+	var msgBroker broker.Broker
+	switch os.Getenv("BROKER") {
+	case "postgres":
+		msgBroker = broker.NewPostgres(dbConn)
+	default:
+		msgBroker = broker.NewMemory()
+	}
+
 	// hub.Run is our central hub that is always listening for client related events.
-	hub := ws.NewHub(dbQueries)
-	go hub.Run(ctx)
+	hub := ws.NewHub(dbQueries, msgBroker)
+
+	// Init content filters. Without a config file, messages are only
+	// sanitized.
+	if path := os.Getenv("FILTER_CONFIG"); path != "" {
+		filters, err := filter.Load(path, filter.Options{
+			AccountCreated: func(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+				user, err := dbQueries.GetUserById(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+				return user.CreatedAt.Time, err
+			},
+		})
+		if err != nil {
+			log.Fatalf("failed to load content filters: %v", err)
+		}
+		hub.SetFilters(filters)
+	}
+
+	// Init heartbeat. Dead connections stop answering pings; idle ones stop
+	// sending anything.
+	heartbeat := ws.DefaultHeartbeat()
+	heartbeat.Interval = durationEnv("WS_PING_INTERVAL", heartbeat.Interval)
+	heartbeat.Timeout = durationEnv("WS_PING_TIMEOUT", heartbeat.Timeout)
+	heartbeat.Idle = durationEnv("WS_IDLE_TIMEOUT", heartbeat.Idle)
+	hub.SetHeartbeat(heartbeat)
+	hubDone := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(hubDone)
+	}()
+
+	// Init websocket handshake. Only our own origin may connect unless
+	// WS_ALLOWED_ORIGINS lists others, comma-separated.
+	handshake := ws.DefaultHandshake()
+	if origins := os.Getenv("WS_ALLOWED_ORIGINS"); origins != "" {
+		for origin := range strings.SplitSeq(origins, ",") {
+			handshake.OriginPatterns = append(handshake.OriginPatterns, strings.TrimSpace(origin))
+		}
+	}
+	handshake.Compression, err = ws.ParseCompression(os.Getenv("WS_COMPRESSION"))
+	if err != nil {
+		log.Fatalf("invalid WS_COMPRESSION: %v", err)
+	}
+	handshake.CompressionThreshold = intEnv("WS_COMPRESSION_THRESHOLD", handshake.CompressionThreshold)
+	handshake.ReadLimits.Max = int64(intEnv("WS_READ_LIMIT", int(handshake.ReadLimits.Max)))
+	handshake.MaxPerIP = intEnv("WS_MAX_CONNS_PER_IP", handshake.MaxPerIP)
+	handshake.MaxPerUser = intEnv("WS_MAX_CONNS_PER_USER", handshake.MaxPerUser)
+	upgrader := ws.NewUpgrader(handshake)
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
@@ -130,6 +158,16 @@ func main() {
 		})
 	defer signupLimiter.Cancel()
 
+	// IP addresses turned away by the rate limiters are recorded to the audit
+	// log, once per limiter window.
+	recordRateLimit := func(r *http.Request) {
+		event := audit.NewEvent(r, audit.EventRateLimited)
+		event.Metadata = map[string]any{"method": r.Method, "path": r.URL.Path}
+		audit.Record(r.Context(), dbQueries, event)
+	}
+	loginLimiter.OnLimit = recordRateLimit
+	signupLimiter.OnLimit = recordRateLimit
+
 	r.Route("/account", func(r chi.Router) {
 		r.Get("/login", handler.ServeLoginPage())
 		r.Post("/login", loginLimiter.Middleware(handler.SubmitLoginForm(dbQueries)))
@@ -142,9 +180,53 @@ func main() {
 
 	r.Group(func(r chi.Router) {
 		r.Use(internal.Middleware(dbQueries))
-		r.Get("/messages", handler.ServeMessages(dbQueries))
-		r.Get("/ws", handler.ServeWs(hub, dbQueries))
-		r.Get("/chat", handler.ServeChat())
+		r.Get("/chat", handler.ServeDefaultRoom())
+		r.Get("/search", handler.ServeSearch(dbQueries))
+		r.Get("/chat/m/{id}", handler.ServePermalink(dbQueries))
+		r.Post("/reports", handler.SubmitReport(dbQueries))
+
+		r.Route("/chat/{room}", func(r chi.Router) {
+			r.Use(handler.RoomMiddleware(dbQueries))
+			r.Get("/", handler.ServeChat())
+			r.Get("/messages", handler.ServeMessages(dbQueries))
+			r.Get("/thread/{id}", handler.ServeThread(dbQueries))
+			r.Get("/pins", handler.ServePins(dbQueries))
+			r.Get("/ws", handler.ServeWs(hub, upgrader, dbQueries))
+		})
+
+		r.Post("/dm", handler.SubmitStartConversation(dbQueries))
+		r.Route("/dm/{username}", func(r chi.Router) {
+			r.Use(handler.ConversationMiddleware(dbQueries))
+			r.Get("/", handler.ServeConversation())
+			r.Get("/messages", handler.ServeMessages(dbQueries))
+			r.Get("/thread/{id}", handler.ServeThread(dbQueries))
+			r.Get("/pins", handler.ServePins(dbQueries))
+			r.Get("/ws", handler.ServeWs(hub, upgrader, dbQueries))
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(internal.RequireRole(dbQueries, auth.RoleAdmin))
+			r.Get("/users", handler.ServeAdminUsers(dbQueries))
+			r.Post("/users/{username}/role", handler.SubmitUserRole(dbQueries))
+			r.Get("/audit", handler.ServeAuditLog(dbQueries))
+			r.Get("/audit/export", handler.ExportAuditLog(dbQueries))
+			r.Get("/queues", handler.ServeQueueMetrics(hub))
+		})
+
+		r.Route("/moderation", func(r chi.Router) {
+			r.Use(internal.RequireRole(dbQueries, auth.RoleModerator))
+			r.Get("/", handler.ServeModeration(dbQueries))
+			r.Post("/users/{username}/{action}", handler.SubmitSanction(hub, dbQueries))
+			r.Get("/reports", handler.ServeReports(dbQueries))
+			r.Post("/reports/{id}/{action}", handler.SubmitReportAction(hub, dbQueries))
+		})
+
+		r.Route("/rooms", func(r chi.Router) {
+			r.Get("/", handler.ServeRooms(dbQueries))
+			r.Post("/", handler.SubmitCreateRoom(dbQueries))
+			r.Post("/{room}/join", handler.SubmitJoinRoom(dbQueries))
+			r.Post("/{room}/leave", handler.SubmitLeaveRoom(hub, dbQueries))
+		})
 	})
 
 	server := &http.Server{
@@ -173,13 +255,43 @@ func main() {
 		log.Println(err)
 	}
 
-	/* 	// Drain NATS connection.
-	   	if err := conn.Drain(); err != nil {
-	   		log.Printf("couldn't drain NATS conn: %+v", err)
-	   	} */
+	// The hub stores the messages still queued before it stops.
+	select {
+	case <-hubDone:
+	case <-shutdownCtx.Done():
+		log.Println("hub did not stop in time")
+	}
 
 	// Close DB connection.
 	dbConn.Close()
 
 	log.Println("Server stopped")
 }
+
+// intEnv reads a number from the environment, falling back to the default
+// when it is not set.
+func intEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", name, err)
+	}
+	return n
+}
+
+// durationEnv reads a duration such as "30s" from the environment, falling
+// back to the default when it is not set.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", name, err)
+	}
+	return d
+}
@@ -0,0 +1,17 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (event, actor_id, target_id, ip, metadata)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ListAuditEvents :many
+SELECT e.id, e.event, e.ip, e.metadata, e.created_at,
+  actors.username AS actor, targets.username AS target
+FROM audit_events e
+LEFT JOIN users actors ON actors.user_id = e.actor_id
+LEFT JOIN users targets ON targets.user_id = e.target_id
+WHERE (@event::text = '' OR e.event = @event)
+AND (@username::text = '' OR actors.username = @username OR targets.username = @username)
+AND (@ip::text = '' OR e.ip = @ip)
+AND (@since::timestamptz IS NULL OR e.created_at >= @since)
+AND (@until::timestamptz IS NULL OR e.created_at < @until)
+ORDER BY e.id DESC
+LIMIT @result_limit;
@@ -15,4 +15,9 @@ WHERE token = $1 AND expires_at > NOW() AND valid = TRUE;
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), valid = FALSE
-WHERE token = $1;
\ No newline at end of file
+WHERE token = $1;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), valid = FALSE
+WHERE user_id = $1 AND valid = TRUE;
@@ -0,0 +1,16 @@
+-- name: GetOrCreateConversation :one
+INSERT INTO conversations (user_a, user_b)
+VALUES ($1, $2)
+ON CONFLICT (user_a, user_b) DO UPDATE SET user_a = EXCLUDED.user_a
+RETURNING *;
+
+-- name: GetConversationByUsers :one
+SELECT * FROM conversations
+WHERE user_a = $1 AND user_b = $2;
+
+-- name: ListConversations :many
+SELECT c.id, u.username
+FROM conversations c
+JOIN users u ON u.user_id = CASE WHEN c.user_a = $1 THEN c.user_b ELSE c.user_a END
+WHERE c.user_a = $1 OR c.user_b = $1
+ORDER BY u.username;
@@ -0,0 +1,30 @@
+-- name: ResolveMentions :many
+SELECT u.user_id, u.username
+FROM users u
+WHERE u.username = ANY(@usernames::text[])
+AND (
+  EXISTS (
+    SELECT 1 FROM room_members rm
+    WHERE rm.room_id = @room_id AND rm.user_id = u.user_id
+  )
+  OR EXISTS (
+    SELECT 1 FROM conversations c
+    WHERE c.id = @conversation_id AND u.user_id IN (c.user_a, c.user_b)
+  )
+);
+
+-- name: CreateMention :exec
+INSERT INTO message_mentions (message_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteMentions :exec
+DELETE FROM message_mentions
+WHERE message_id = $1;
+
+-- name: ListMentions :many
+SELECT mm.message_id, u.user_id, u.username
+FROM message_mentions mm
+JOIN users u ON mm.user_id = u.user_id
+WHERE mm.message_id = ANY(@messages::bigint[])
+ORDER BY mm.message_id, u.username;
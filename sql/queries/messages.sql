@@ -1,11 +1,143 @@
 -- name: CreateMessage :one
-INSERT INTO messages (user_id, content, created_at)
-VALUES ($1, $2, $3)
+INSERT INTO messages (user_id, room_id, conversation_id, parent_id, content, created_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: CreateMessages :many
+WITH batch AS MATERIALIZED (
+    SELECT nextval(pg_get_serial_sequence('messages', 'id')) AS id, b.*
+    FROM unnest(
+        @users::uuid[], @rooms::bigint[], @conversations::bigint[],
+        @parents::bigint[], @contents::text[], @created::timestamptz[]
+    ) WITH ORDINALITY AS b(user_id, room_id, conversation_id, parent_id, content, created_at, position)
+    ORDER BY b.position
+), inserted AS (
+    INSERT INTO messages (id, user_id, room_id, conversation_id, parent_id, content, created_at)
+    OVERRIDING SYSTEM VALUE
+    SELECT id, user_id, NULLIF(room_id, 0), NULLIF(conversation_id, 0), NULLIF(parent_id, 0), content, created_at
+    FROM batch
+    RETURNING id, created_at
+)
+SELECT batch.position, inserted.id, inserted.created_at
+FROM inserted
+JOIN batch ON batch.id = inserted.id;
+
+-- name: GetMessage :one
+SELECT * FROM messages
+WHERE id = $1;
+
+-- name: UpdateMessageContent :one
+UPDATE messages
+SET content = $2, edited_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: DeleteMessage :one
+UPDATE messages
+SET content = '', deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
 RETURNING *;
 
 -- name: ListMessages :many
-SELECT m.id, m.user_id, m.content, m.created_at, u.username
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.room_id = $1 AND m.parent_id IS NULL
+ORDER BY m.id DESC
+LIMIT $2;
+
+-- name: ListConversationMessages :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.conversation_id = $1 AND m.parent_id IS NULL
+ORDER BY m.id DESC
+LIMIT $2;
+
+-- name: ListMessagesAfter :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.room_id = $1 AND m.id > $2 AND m.parent_id IS NULL
+ORDER BY m.id ASC
+LIMIT $3;
+
+-- name: ListConversationMessagesAfter :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.conversation_id = $1 AND m.id > $2 AND m.parent_id IS NULL
+ORDER BY m.id ASC
+LIMIT $3;
+
+-- name: ListMessagesBefore :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.room_id = $1 AND m.id < $2 AND m.parent_id IS NULL
+ORDER BY m.id DESC
+LIMIT $3;
+
+-- name: ListConversationMessagesBefore :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE m.conversation_id = $1 AND m.id < $2 AND m.parent_id IS NULL
+ORDER BY m.id DESC
+LIMIT $3;
+
+-- name: ListMessagesAround :many
+SELECT id, user_id, content, created_at, edited_at, deleted_at, username
+FROM (
+  (
+    SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+    FROM messages m
+    JOIN users u ON m.user_id = u.user_id
+    WHERE (m.room_id = @room_id OR m.conversation_id = @conversation_id)
+    AND m.id <= @id AND m.parent_id IS NULL
+    ORDER BY m.id DESC
+    LIMIT @before_limit
+  )
+  UNION ALL
+  (
+    SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+    FROM messages m
+    JOIN users u ON m.user_id = u.user_id
+    WHERE (m.room_id = @room_id OR m.conversation_id = @conversation_id)
+    AND m.id > @id AND m.parent_id IS NULL
+    ORDER BY m.id ASC
+    LIMIT @after_limit
+  )
+) AS around
+ORDER BY id;
+
+-- name: GetMessageChannel :one
+SELECT m.id, m.parent_id, r.name AS room_name, p.username AS peer_username
+FROM messages m
+LEFT JOIN rooms r ON m.room_id = r.id
+LEFT JOIN conversations c ON m.conversation_id = c.id
+LEFT JOIN users p ON p.user_id = CASE WHEN c.user_a = @user_id THEN c.user_b ELSE c.user_a END
+WHERE m.id = @id
+AND (
+  EXISTS (
+    SELECT 1 FROM room_members rm
+    WHERE rm.room_id = m.room_id AND rm.user_id = @user_id
+  )
+  OR @user_id IN (c.user_a, c.user_b)
+);
+
+-- name: ListThread :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+WHERE (m.id = @parent_id OR (m.parent_id = @parent_id AND m.deleted_at IS NULL))
+AND m.room_id IS NOT DISTINCT FROM @room_id
+AND m.conversation_id IS NOT DISTINCT FROM @conversation_id
+ORDER BY m.id;
+
+-- name: ListThreadSummaries :many
+SELECT DISTINCT ON (m.parent_id) m.parent_id, COUNT(*) OVER (PARTITION BY m.parent_id) AS replies, m.content, u.username
 FROM messages m
 JOIN users u ON m.user_id = u.user_id
-ORDER BY m.created_at DESC
-LIMIT $1;
\ No newline at end of file
+WHERE m.parent_id = ANY(@messages::bigint[]) AND m.deleted_at IS NULL
+ORDER BY m.parent_id, m.id DESC;
@@ -0,0 +1,23 @@
+-- name: PinMessage :execrows
+INSERT INTO pinned_messages (message_id, pinned_by)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: UnpinMessage :execrows
+DELETE FROM pinned_messages
+WHERE message_id = $1;
+
+-- name: IsPinned :one
+SELECT EXISTS (
+  SELECT 1 FROM pinned_messages
+  WHERE message_id = $1
+);
+
+-- name: ListPins :many
+SELECT m.id, u.username, LEFT(m.content, 200)::text AS content
+FROM pinned_messages p
+JOIN messages m ON p.message_id = m.id
+JOIN users u ON m.user_id = u.user_id
+WHERE (m.room_id = @room_id OR m.conversation_id = @conversation_id)
+AND m.deleted_at IS NULL
+ORDER BY p.pinned_at DESC;
@@ -0,0 +1,15 @@
+-- name: AddReaction :execrows
+INSERT INTO message_reactions (message_id, user_id, emoji)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveReaction :execrows
+DELETE FROM message_reactions
+WHERE message_id = $1 AND user_id = $2 AND emoji = $3;
+
+-- name: ListReactions :many
+SELECT message_id, emoji, ARRAY_AGG(user_id ORDER BY created_at)::uuid[] AS users
+FROM message_reactions
+WHERE message_id = ANY(@messages::bigint[])
+GROUP BY message_id, emoji
+ORDER BY message_id, MIN(created_at);
@@ -0,0 +1,16 @@
+-- name: GetReadMarker :one
+SELECT last_read_id FROM read_markers
+WHERE user_id = $1 AND (room_id = $2 OR conversation_id = $3);
+
+-- name: MarkRead :one
+INSERT INTO read_markers (user_id, room_id, conversation_id, last_read_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, room_id, conversation_id)
+DO UPDATE SET last_read_id = GREATEST(read_markers.last_read_id, EXCLUDED.last_read_id), updated_at = NOW()
+RETURNING last_read_id;
+
+-- name: CountUnread :one
+SELECT COUNT(*) FROM messages
+WHERE (room_id = @room_id OR conversation_id = @conversation_id)
+AND id > @last_read_id AND user_id <> @user_id
+AND parent_id IS NULL AND deleted_at IS NULL;
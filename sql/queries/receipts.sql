@@ -0,0 +1,37 @@
+-- name: MarkDelivered :many
+INSERT INTO message_receipts (message_id, user_id)
+SELECT m.id, @user_id::uuid
+FROM messages m
+WHERE m.id = ANY(@messages::bigint[])
+AND (m.room_id = @room_id OR m.conversation_id = @conversation_id)
+AND m.user_id <> @user_id
+ON CONFLICT DO NOTHING
+RETURNING message_id;
+
+-- name: MarkSeen :one
+WITH batch AS (
+    SELECT m.id
+    FROM messages m
+    WHERE m.user_id <> @user_id
+    AND (m.room_id = @room_id OR m.conversation_id = @conversation_id)
+    AND m.id > @read_after AND m.id <= @read_up_to
+    AND m.parent_id IS NULL
+    ORDER BY m.id
+    LIMIT 500
+), marked AS (
+    INSERT INTO message_receipts (message_id, user_id, read_at)
+    SELECT batch.id, @user_id::uuid, NOW()
+    FROM batch
+    ON CONFLICT (message_id, user_id) DO UPDATE SET read_at = NOW()
+    WHERE message_receipts.read_at IS NULL
+    RETURNING message_id
+)
+SELECT COALESCE((SELECT MAX(batch.id) FROM batch), 0)::bigint AS last_id,
+COALESCE((SELECT array_agg(marked.message_id) FROM marked), '{}')::bigint[] AS messages;
+
+-- name: ListReceipts :many
+SELECT m.id, m.user_id, m.room_id, m.conversation_id, COUNT(r.user_id) AS delivered, COUNT(r.read_at) AS seen
+FROM messages m
+LEFT JOIN message_receipts r ON r.message_id = m.id
+WHERE m.id = ANY(@messages::bigint[])
+GROUP BY m.id;
@@ -0,0 +1,21 @@
+-- name: CreateReport :execrows
+INSERT INTO reports (message_id, reporter_id, reason)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: ListOpenReports :many
+SELECT r.id, r.reason, r.created_at, reporters.username AS reporter,
+  m.id AS message_id, m.room_id, m.conversation_id, m.parent_id,
+  authors.username AS author, authors.role AS author_role, rooms.name AS room_name
+FROM reports r
+JOIN messages m ON m.id = r.message_id
+LEFT JOIN users reporters ON reporters.user_id = r.reporter_id
+JOIN users authors ON authors.user_id = m.user_id
+LEFT JOIN rooms ON rooms.id = m.room_id
+WHERE r.status = 'open'
+ORDER BY r.created_at;
+
+-- name: CloseReports :execrows
+UPDATE reports
+SET status = $2, resolved_by = $3, resolved_at = NOW()
+WHERE message_id = $1 AND status = 'open';
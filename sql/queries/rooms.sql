@@ -0,0 +1,30 @@
+-- name: CreateRoom :one
+INSERT INTO rooms (name, created_by)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetRoomByName :one
+SELECT * FROM rooms
+WHERE name = $1;
+
+-- name: ListRooms :many
+SELECT r.id, r.name, r.created_at,
+  (rm.user_id IS NOT NULL)::boolean AS is_member
+FROM rooms r
+LEFT JOIN room_members rm ON rm.room_id = r.id AND rm.user_id = $1
+ORDER BY r.name;
+
+-- name: JoinRoom :exec
+INSERT INTO room_members (room_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (room_id, user_id) DO NOTHING;
+
+-- name: LeaveRoom :exec
+DELETE FROM room_members
+WHERE room_id = $1 AND user_id = $2;
+
+-- name: IsRoomMember :one
+SELECT EXISTS (
+  SELECT 1 FROM room_members
+  WHERE room_id = $1 AND user_id = $2
+);
@@ -0,0 +1,32 @@
+-- name: CreateSanction :one
+INSERT INTO sanctions (user_id, kind, reason, actor_id, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: ReplaceSanction :one
+WITH revoked AS (
+    UPDATE sanctions
+    SET revoked_at = NOW()
+    WHERE user_id = $1 AND kind = $2 AND revoked_at IS NULL
+)
+INSERT INTO sanctions (user_id, kind, reason, actor_id, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetActiveSanction :one
+SELECT * FROM sanctions
+WHERE user_id = $1 AND kind = $2 AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY expires_at DESC NULLS FIRST
+LIMIT 1;
+
+-- name: ListActiveSanctions :many
+SELECT * FROM sanctions
+WHERE kind IN ('mute', 'ban') AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY created_at;
+
+-- name: RevokeSanctions :execrows
+UPDATE sanctions
+SET revoked_at = NOW()
+WHERE user_id = $1 AND kind = $2 AND revoked_at IS NULL;
@@ -0,0 +1,25 @@
+-- name: SearchMessages :many
+SELECT m.id, m.user_id, m.content, m.created_at, m.edited_at, m.deleted_at, u.username,
+  r.name AS room_name, p.username AS peer_username
+FROM messages m
+JOIN users u ON m.user_id = u.user_id
+LEFT JOIN rooms r ON m.room_id = r.id
+LEFT JOIN conversations c ON m.conversation_id = c.id
+LEFT JOIN users p ON p.user_id = CASE WHEN c.user_a = @user_id THEN c.user_b ELSE c.user_a END
+WHERE m.search @@ websearch_to_tsquery('english', @query)
+AND m.deleted_at IS NULL
+AND (
+  EXISTS (
+    SELECT 1 FROM room_members rm
+    WHERE rm.room_id = m.room_id AND rm.user_id = @user_id
+  )
+  OR @user_id IN (c.user_a, c.user_b)
+)
+AND (@author::text = '' OR u.username = @author)
+AND (@since::timestamptz IS NULL OR m.created_at >= @since)
+AND (@until::timestamptz IS NULL OR m.created_at < @until)
+AND (NOT @has_mention::boolean OR EXISTS (
+  SELECT 1 FROM message_mentions mm WHERE mm.message_id = m.id
+))
+ORDER BY ts_rank(m.search, websearch_to_tsquery('english', @query)) DESC, m.id DESC
+LIMIT @result_limit;
@@ -12,4 +12,21 @@ WHERE u.email = $1;
 
 -- name: GetUserById :one
 SELECT * FROM users
-WHERE user_id = $1;
\ No newline at end of file
+WHERE user_id = $1;
+
+-- name: GetUserByUsername :one
+SELECT * FROM users
+WHERE username = $1;
+
+-- name: GetUserRole :one
+SELECT role FROM users
+WHERE user_id = $1;
+
+-- name: ListUsers :many
+SELECT * FROM users
+ORDER BY username;
+
+-- name: SetUserRole :execrows
+UPDATE users
+SET role = $2
+WHERE username = $1;
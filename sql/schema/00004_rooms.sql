@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE rooms (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  name TEXT UNIQUE NOT NULL,
+  created_by UUID REFERENCES users(user_id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE room_members (
+  room_id BIGINT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  joined_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (room_id, user_id)
+);
+
+-- Existing users and messages are moved into the default room.
+INSERT INTO rooms (name) VALUES ('general');
+
+INSERT INTO room_members (room_id, user_id)
+SELECT r.id, u.user_id
+FROM rooms r CROSS JOIN users u
+WHERE r.name = 'general';
+
+ALTER TABLE messages ADD COLUMN room_id BIGINT REFERENCES rooms(id) ON DELETE CASCADE;
+UPDATE messages SET room_id = (SELECT id FROM rooms WHERE name = 'general');
+ALTER TABLE messages ALTER COLUMN room_id SET NOT NULL;
+
+CREATE INDEX messages_room_id_id_idx ON messages (room_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages DROP COLUMN room_id;
+DROP TABLE room_members, rooms;
+-- +goose StatementEnd
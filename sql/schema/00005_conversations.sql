@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A conversation is a private channel between exactly two users. The pair
+-- is stored in a canonical order so each pair maps to a single row.
+CREATE TABLE conversations (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  user_a UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  user_b UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CHECK (user_a < user_b),
+  UNIQUE (user_a, user_b)
+);
+
+CREATE INDEX conversations_user_b_idx ON conversations (user_b);
+
+-- Messages belong either to a room or to a conversation.
+ALTER TABLE messages ALTER COLUMN room_id DROP NOT NULL;
+ALTER TABLE messages ADD COLUMN conversation_id BIGINT REFERENCES conversations(id) ON DELETE CASCADE;
+ALTER TABLE messages ADD CONSTRAINT messages_channel_check
+  CHECK ((room_id IS NULL) <> (conversation_id IS NULL));
+
+CREATE INDEX messages_conversation_id_id_idx ON messages (conversation_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM messages WHERE conversation_id IS NOT NULL;
+ALTER TABLE messages DROP CONSTRAINT messages_channel_check;
+ALTER TABLE messages DROP COLUMN conversation_id;
+ALTER TABLE messages ALTER COLUMN room_id SET NOT NULL;
+DROP TABLE conversations;
+-- +goose StatementEnd
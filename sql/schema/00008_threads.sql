@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Replies point to the message starting their thread. Threads are a single
+-- level deep: replies are never parents themselves.
+ALTER TABLE messages ADD COLUMN parent_id BIGINT REFERENCES messages(id) ON DELETE CASCADE;
+
+CREATE INDEX messages_parent_id_idx ON messages (parent_id, id) WHERE parent_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX messages_parent_id_idx;
+ALTER TABLE messages DROP COLUMN parent_id;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Users mentioned in a message with @username.
+CREATE TABLE message_mentions (
+  message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX message_mentions_user_id_idx ON message_mentions (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE message_mentions;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The last message each user read in every room and conversation.
+CREATE TABLE read_markers (
+  user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  room_id BIGINT REFERENCES rooms(id) ON DELETE CASCADE,
+  conversation_id BIGINT REFERENCES conversations(id) ON DELETE CASCADE,
+  last_read_id BIGINT NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CHECK ((room_id IS NULL) <> (conversation_id IS NULL)),
+  UNIQUE NULLS NOT DISTINCT (user_id, room_id, conversation_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE read_markers;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Delivery and read state of every message, per recipient. A receipt is
+-- created once the recipient's browser rendered the message, or read it.
+CREATE TABLE message_receipts (
+  message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  delivered_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  read_at TIMESTAMPTZ,
+  PRIMARY KEY (message_id, user_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE message_receipts;
+-- +goose StatementEnd
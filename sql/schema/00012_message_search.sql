@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Full-text search over message contents. The column is kept up to date by
+-- Postgres; edits and deletions are reflected automatically.
+ALTER TABLE messages ADD COLUMN search TSVECTOR
+  GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+
+CREATE INDEX messages_search_idx ON messages USING GIN (search);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX messages_search_idx;
+ALTER TABLE messages DROP COLUMN search;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Messages pinned to the top of their room or conversation.
+CREATE TABLE pinned_messages (
+  message_id BIGINT PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+  pinned_by UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  pinned_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE pinned_messages;
+-- +goose StatementEnd
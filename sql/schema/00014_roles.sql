@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Roles grant permissions on top of the member's: moderators moderate every
+-- channel, admins also manage the roles of other users. Every role holds the
+-- permissions of the roles below it.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'member'
+  CHECK (role IN ('member', 'moderator', 'admin'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN role;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Moderation actions taken against a user. Kicks only close the user's
+-- connections; mutes and bans stay in effect until they expire or are
+-- revoked. Bans without an expiry are permanent.
+CREATE TABLE sanctions (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  kind TEXT NOT NULL CHECK (kind IN ('kick', 'mute', 'ban')),
+  reason TEXT NOT NULL DEFAULT '',
+  actor_id UUID REFERENCES users(user_id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX sanctions_user_id_idx ON sanctions (user_id, kind);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE sanctions;
+-- +goose StatementEnd
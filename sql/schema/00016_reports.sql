@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Messages reported by users, waiting for a moderator while open. A user can
+-- only have one open report per message.
+CREATE TABLE reports (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  reporter_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  reason TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  resolved_by UUID REFERENCES users(user_id) ON DELETE SET NULL,
+  resolved_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX reports_open_idx ON reports (message_id, reporter_id) WHERE status = 'open';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE reports;
+-- +goose StatementEnd
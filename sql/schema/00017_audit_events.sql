@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Security and moderation events. The table is append-only: rows reference
+-- users without foreign keys so that they are never rewritten, and a trigger
+-- rejects updates and deletions.
+CREATE TABLE audit_events (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  event TEXT NOT NULL,
+  actor_id UUID,
+  target_id UUID,
+  ip TEXT NOT NULL DEFAULT '',
+  metadata JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE FUNCTION reject_audit_event_change() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION reject_audit_event_change();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE audit_events;
+DROP FUNCTION reject_audit_event_change();
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Content filters treat new accounts differently. Existing users get the
+-- time they set their password, which is when they signed up.
+ALTER TABLE users ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE users SET created_at = passwords.created_at
+FROM passwords
+WHERE passwords.user_id = users.user_id;
+
+-- Messages flagged by a content filter are reported without a reporter. They
+-- still only have one open report: NULL reporters are not distinct.
+ALTER TABLE reports ALTER COLUMN reporter_id DROP NOT NULL;
+DROP INDEX reports_open_idx;
+CREATE UNIQUE INDEX reports_open_idx ON reports (message_id, reporter_id) NULLS NOT DISTINCT WHERE status = 'open';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM reports WHERE reporter_id IS NULL;
+ALTER TABLE reports ALTER COLUMN reporter_id SET NOT NULL;
+DROP INDEX reports_open_idx;
+CREATE UNIQUE INDEX reports_open_idx ON reports (message_id, reporter_id) WHERE status = 'open';
+
+ALTER TABLE users DROP COLUMN created_at;
+-- +goose StatementEnd